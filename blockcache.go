@@ -0,0 +1,136 @@
+package squashfs
+
+import (
+	"container/list"
+	"sync"
+)
+
+// defaultCacheSize is the default amount of decompressed data kept in memory per superblock
+const defaultCacheSize = 8 * 1024 * 1024
+
+// blockCache is a size-bounded LRU cache of decompressed data blocks, keyed
+// by the block's position in the image. Buffers returned by the cache are
+// shared and must not be modified.
+type blockCache struct {
+	lk      sync.Mutex
+	max     int
+	size    int
+	lru     *list.List
+	items   map[uint64]*list.Element
+	loading map[uint64]*blockLoad // blocks being loaded, see load
+}
+
+type blockCacheEntry struct {
+	key  uint64
+	data []byte
+}
+
+// blockLoad is a block being loaded, other readers of the same block wait
+// for done to be closed
+type blockLoad struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+func newBlockCache(max int) *blockCache {
+	return &blockCache{
+		max:     max,
+		lru:     list.New(),
+		items:   make(map[uint64]*list.Element),
+		loading: make(map[uint64]*blockLoad),
+	}
+}
+
+// load returns the cached data for key, or calls fn to load it. Concurrent
+// calls for the same key, such as readahead and a read catching up with it,
+// share a single call to fn.
+func (c *blockCache) load(key uint64, fn func() ([]byte, error)) ([]byte, error) {
+	c.lk.Lock()
+	if e, ok := c.items[key]; ok {
+		c.lru.MoveToFront(e)
+		c.lk.Unlock()
+		return e.Value.(*blockCacheEntry).data, nil
+	}
+	if l, ok := c.loading[key]; ok {
+		c.lk.Unlock()
+		<-l.done
+		return l.data, l.err
+	}
+	l := &blockLoad{done: make(chan struct{})}
+	c.loading[key] = l
+	c.lk.Unlock()
+
+	l.data, l.err = fn()
+	if l.err == nil {
+		c.add(key, l.data)
+	}
+
+	c.lk.Lock()
+	delete(c.loading, key)
+	c.lk.Unlock()
+	close(l.done)
+	return l.data, l.err
+}
+
+func (c *blockCache) add(key uint64, data []byte) {
+	if len(data) > c.max {
+		// also covers disabled cache (max=0)
+		return
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		// already added by someone else
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	c.items[key] = c.lru.PushFront(&blockCacheEntry{key: key, data: data})
+	c.size += len(data)
+
+	for c.size > c.max {
+		e := c.lru.Back()
+		ent := e.Value.(*blockCacheEntry)
+		c.lru.Remove(e)
+		delete(c.items, ent.key)
+		c.size -= len(ent.data)
+	}
+}
+
+// readDataBlock returns the decompressed data block found at a given offset,
+// with size being the on-disk size as found in the inode's block list.
+func (sb *Superblock) readDataBlock(start uint64, size uint32) ([]byte, error) {
+	return sb.blockCache.load(start, func() ([]byte, error) {
+		return sb.loadDataBlock(start, size)
+	})
+}
+
+// loadDataBlock reads and decompresses a data block, bypassing the cache
+func (sb *Superblock) loadDataBlock(start uint64, size uint32) ([]byte, error) {
+	var buf []byte
+	if size&0x1000000 == 0 {
+		// compressed, read into a temporary buffer
+		p := getBuf(int(size & (0x1000000 - 1)))
+		defer putBuf(p)
+
+		err := sb.readAt(*p, int64(start), "data block")
+		if err != nil {
+			return nil, err
+		}
+		buf, err = sb.decompress(*p)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		buf = make([]byte, size&(0x1000000-1))
+		err := sb.readAt(buf, int64(start), "data block")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,62 @@
+package squashfs
+
+import "io/fs"
+
+// BlockInfo describes where a part of a regular file is stored in the image
+type BlockInfo struct {
+	Offset         uint64 // position of the (possibly compressed) block, relative to the start of the image
+	CompressedSize uint32 // size of the block on disk
+	Uncompressed   bool   // block is stored without compression
+	Size           uint32 // amount of data of the file in this block, once decompressed
+
+	// Sparse blocks contain only zeroes and are not stored on disk
+	Sparse bool
+
+	// Fragment is set for the tail end of a file stored in a fragment block.
+	// In this case Offset and CompressedSize describe the whole fragment
+	// block, and the file's data starts at FragOffset once decompressed.
+	Fragment   bool
+	FragOffset uint32
+}
+
+// BlockInfo returns the list of blocks containing the data of a regular file,
+// in order. This can be used to fetch and decompress blocks directly.
+func (i *Inode) BlockInfo() ([]BlockInfo, error) {
+	switch i.Type {
+	case 2, 9:
+	default:
+		return nil, fs.ErrInvalid
+	}
+
+	res := make([]BlockInfo, len(i.Blocks))
+
+	for n, blk := range i.Blocks {
+		size := uint64(i.sb.BlockSize)
+		if remain := i.Size - uint64(n)*uint64(i.sb.BlockSize); remain < size {
+			size = remain
+		}
+		info := BlockInfo{Size: uint32(size)}
+
+		switch blk {
+		case 0xffffffff:
+			ent, err := i.sb.getFragEntry(i.FragBlock)
+			if err != nil {
+				return nil, err
+			}
+			info.Fragment = true
+			info.FragOffset = i.FragOfft
+			info.Offset = ent.start
+			info.CompressedSize = ent.size & (0x1000000 - 1)
+			info.Uncompressed = ent.size&0x1000000 != 0
+		case 0:
+			info.Sparse = true
+		default:
+			info.Offset = i.StartBlock + i.BlocksOfft[n]
+			info.CompressedSize = blk & (0x1000000 - 1)
+			info.Uncompressed = blk&0x1000000 != 0
+		}
+		res[n] = info
+	}
+
+	return res, nil
+}
@@ -0,0 +1,66 @@
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"sync"
+)
+
+// bufPool holds buffers used to read compressed blocks from the image, which
+// are not needed anymore once decompressed.
+var bufPool sync.Pool
+
+// getBuf returns a buffer of n bytes from the pool, which should be returned
+// with putBuf once not needed anymore.
+func getBuf(n int) *[]byte {
+	if p, ok := bufPool.Get().(*[]byte); ok && cap(*p) >= n {
+		*p = (*p)[:n]
+		return p
+	}
+	buf := make([]byte, n)
+	return &buf
+}
+
+func putBuf(p *[]byte) {
+	bufPool.Put(p)
+}
+
+var (
+	zlibPool   sync.Pool // zlib readers, reused through zlib.Resetter
+	outBufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+)
+
+// zlibDecompress is the default GZip decompressor. Unlike the decompressors
+// returned by MakeDecompressor, it reuses zlib readers and output buffers
+// between calls to reduce allocations.
+func zlibDecompress(buf []byte) ([]byte, error) {
+	r := bytes.NewReader(buf)
+
+	var z io.ReadCloser
+	var err error
+	if p, ok := zlibPool.Get().(io.ReadCloser); ok {
+		z = p
+		err = z.(zlib.Resetter).Reset(r, nil)
+	} else {
+		z, err = zlib.NewReader(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer zlibPool.Put(z)
+
+	w := outBufPool.Get().(*bytes.Buffer)
+	defer outBufPool.Put(w)
+	w.Reset()
+
+	_, err = w.ReadFrom(z)
+	if err != nil {
+		return nil, err
+	}
+
+	// the result may be kept in cache, so it cannot come from the pool
+	res := make([]byte, w.Len())
+	copy(res, w.Bytes())
+	return res, nil
+}
@@ -2,9 +2,9 @@ package squashfs
 
 import (
 	"bytes"
-	"compress/zlib"
 	"fmt"
 	"io"
+	"sync"
 )
 
 type Compression uint16
@@ -18,9 +18,14 @@ const (
 	ZSTD
 )
 
+// Decompressor decompresses a block. buf may be reused once the call returns
+// and must not be retained.
 type Decompressor func(buf []byte) ([]byte, error)
 
-var decompressHandler = map[Compression]Decompressor{GZip: MakeDecompressorErr(zlib.NewReader)}
+var (
+	decompressHandler  = map[Compression]Decompressor{GZip: zlibDecompress}
+	decompressHandlerL sync.RWMutex
+)
 
 func (s Compression) String() string {
 	switch s {
@@ -40,17 +45,75 @@ func (s Compression) String() string {
 	return fmt.Sprintf("Compression(%d)", s)
 }
 
-func (s Compression) decompress(buf []byte) ([]byte, error) {
-	if f, ok := decompressHandler[s]; ok {
+// decompress decompresses buf using a handler registered on this superblock
+// if any, or the globally registered handler for the compression method.
+func (sb *Superblock) decompress(buf []byte) ([]byte, error) {
+	if err := sb.Comp.checkHeader(buf); err != nil {
+		return nil, err
+	}
+	if f, ok := sb.decompressHandler[sb.Comp]; ok {
 		return f(buf)
 	}
-	return nil, fmt.Errorf("unsupported compression format %s", s.String())
+
+	decompressHandlerL.RLock()
+	f, ok := decompressHandler[sb.Comp]
+	decompressHandlerL.RUnlock()
+
+	switch {
+	case ok:
+		return f(buf)
+	case sb.Comp == LZ4:
+		// built in, bounded by the largest block found in this image
+		max := int(sb.BlockSize)
+		if max < MetadataBlockSize {
+			max = MetadataBlockSize
+		}
+		return lz4Decompress(buf, max)
+	}
+	return nil, fmt.Errorf("unsupported compression format %s", sb.Comp.String())
+}
+
+// checkHeader verifies that a compressed block starts with the header of the
+// compression method, for the methods having one. LZO and LZ4 blocks have no
+// header and cannot be verified.
+func (s Compression) checkHeader(buf []byte) error {
+	if s.hasHeader(buf) {
+		return nil
+	}
+	for _, m := range []Compression{GZip, LZMA, XZ, ZSTD} {
+		if m != s && m.hasHeader(buf) {
+			return fmt.Errorf("%w: expected %s, found %s data", ErrWrongCompression, s, m)
+		}
+	}
+	return fmt.Errorf("%w: expected %s, found unknown data", ErrWrongCompression, s)
+}
+
+// hasHeader returns true if buf starts with a valid header for the method
+func (s Compression) hasHeader(buf []byte) bool {
+	switch s {
+	case GZip:
+		// zlib header: deflate method and check bits
+		return len(buf) >= 2 && buf[0]&0x0f == 8 && (uint16(buf[0])<<8|uint16(buf[1]))%31 == 0
+	case LZMA:
+		// lzma alone header: 13 bytes, starting with the lc/lp/pb properties byte
+		return len(buf) >= 13 && buf[0] < 9*5*5
+	case XZ:
+		return bytes.HasPrefix(buf, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00})
+	case ZSTD:
+		return bytes.HasPrefix(buf, []byte{0x28, 0xb5, 0x2f, 0xfd})
+	}
+	// no header to check
+	return true
 }
 
 // RegisterDecompressor can be used to register a decompressor for squashfs.
 // By default GZip is supported. The method shall take a buffer and return a
 // decompressed buffer.
+//
+// It is safe to call RegisterDecompressor while images are being read.
 func RegisterDecompressor(method Compression, dcomp Decompressor) {
+	decompressHandlerL.Lock()
+	defer decompressHandlerL.Unlock()
 	decompressHandler[method] = dcomp
 }
 
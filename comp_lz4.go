@@ -0,0 +1,17 @@
+package squashfs
+
+import "github.com/pierrec/lz4/v4"
+
+// lz4Decompress decodes a raw LZ4 block (squashfs does not use the LZ4 frame
+// format) of at most max bytes once decompressed. Blocks compressed in HC mode
+// use the same block format.
+func lz4Decompress(buf []byte, max int) ([]byte, error) {
+	p := getBuf(max)
+	defer putBuf(p)
+
+	n, err := lz4.UncompressBlock(buf, *p)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), (*p)[:n]...), nil
+}
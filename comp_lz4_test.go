@@ -0,0 +1,28 @@
+package squashfs
+
+import "testing"
+
+func TestLz4Decompress(t *testing.T) {
+	// "hello " + match(offset=6, len=24) + "world"
+	in := []byte{0x6f, 'h', 'e', 'l', 'l', 'o', ' ', 0x06, 0x00, 0x05, 0x50, 'w', 'o', 'r', 'l', 'd'}
+
+	res, err := lz4Decompress(in, 64)
+	if err != nil {
+		t.Fatalf("failed to decompress lz4 block: %s", err)
+	}
+	if string(res) != "hello hello hello hello hello world" {
+		t.Errorf("invalid lz4 output: %q", res)
+	}
+
+	// output larger than the maximum block size
+	_, err = lz4Decompress(in, 16)
+	if err == nil {
+		t.Errorf("lz4 decompression beyond the maximum size did not fail")
+	}
+
+	// offset pointing before start of output
+	_, err = lz4Decompress([]byte{0x10, 'a', 0x05, 0x00}, 64)
+	if err == nil {
+		t.Errorf("lz4 decompression of corrupt block did not fail")
+	}
+}
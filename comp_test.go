@@ -0,0 +1,35 @@
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"testing"
+)
+
+func TestDecompressWrongHeader(t *testing.T) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte("hello world"))
+	w.Close()
+
+	sb := &Superblock{Comp: GZip}
+	res, err := sb.decompress(buf.Bytes())
+	if err != nil || string(res) != "hello world" {
+		t.Errorf("failed to decompress zlib block: %v", err)
+	}
+
+	// the same block in a xz archive
+	sb = &Superblock{Comp: XZ}
+	_, err = sb.decompress(buf.Bytes())
+	if !errors.Is(err, ErrWrongCompression) {
+		t.Errorf("decompressing zlib block as xz returned unexpected err=%v", err)
+	}
+
+	// xz block in a zlib archive
+	sb = &Superblock{Comp: GZip}
+	_, err = sb.decompress([]byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00, 0x04})
+	if !errors.Is(err, ErrWrongCompression) {
+		t.Errorf("decompressing xz block as zlib returned unexpected err=%v", err)
+	}
+}
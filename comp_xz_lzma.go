@@ -0,0 +1,28 @@
+package squashfs
+
+import (
+	"io"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+func init() {
+	RegisterDecompressor(XZ, MakeDecompressorErr(func(r io.Reader) (io.ReadCloser, error) {
+		rc, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(rc), nil
+	}))
+
+	// squashfs-tools writes legacy LZMA blocks in the lzma_alone format, with
+	// the uncompressed size of the block filled in the 13 bytes header
+	RegisterDecompressor(LZMA, MakeDecompressorErr(func(r io.Reader) (io.ReadCloser, error) {
+		rc, err := lzma.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(rc), nil
+	}))
+}
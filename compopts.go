@@ -0,0 +1,73 @@
+package squashfs
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// GZipOptions are the compressor options stored for GZip compressed images
+type GZipOptions struct {
+	CompressionLevel uint32
+	WindowSize       uint16
+	Strategies       uint16
+}
+
+// XZOptions are the compressor options stored for XZ compressed images
+type XZOptions struct {
+	DictionarySize    uint32
+	ExecutableFilters uint32
+}
+
+// LZ4Options are the compressor options stored for LZ4 compressed images
+type LZ4Options struct {
+	Version uint32
+	Flags   uint32 // 1 = LZ4 HC
+}
+
+// ZSTDOptions are the compressor options stored for ZSTD compressed images
+type ZSTDOptions struct {
+	CompressionLevel uint32
+}
+
+// LZOOptions are the compressor options stored for LZO compressed images
+type LZOOptions struct {
+	Algorithm        uint32
+	CompressionLevel uint32
+}
+
+// readCompressorOptions parses the compressor options metadata block that
+// directly follows the superblock when the COMPRESSOR_OPTIONS flag is set.
+func (sb *Superblock) readCompressorOptions() error {
+	if !sb.Flags.Has(COMPRESSOR_OPTIONS) {
+		return nil
+	}
+
+	var opts any
+	switch sb.Comp {
+	case GZip:
+		opts = &GZipOptions{}
+	case XZ:
+		opts = &XZOptions{}
+	case LZ4:
+		opts = &LZ4Options{}
+	case ZSTD:
+		opts = &ZSTDOptions{}
+	case LZO:
+		opts = &LZOOptions{}
+	default:
+		// LZMA has no options
+		return nil
+	}
+
+	r, err := sb.newTableReader(SuperblockSize, 0)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(r, sb.order, opts)
+	if err != nil {
+		return fmt.Errorf("failed to read %s compressor options: %w", sb.Comp, err)
+	}
+
+	sb.CompressorOptions = opts
+	return nil
+}
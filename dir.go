@@ -11,12 +11,15 @@ type dirReader struct {
 	r  *io.LimitedReader
 
 	count, startBlock, inodeNum uint32
+
+	lastIno uint32 // inode number of the last entry returned by nextfull
 }
 
 type direntry struct {
 	name string
 	typ  Type // squashfs type
 	inoR inodeRef
+	ino  uint32 // inode number
 	sb   *Superblock
 }
 
@@ -99,6 +102,7 @@ func (dr *dirReader) nextfull() (string, Type, inodeRef, error) {
 	}
 
 	dr.count -= 1
+	dr.lastIno = uint32(int64(dr.inodeNum) + int64(inoNum2))
 
 	inoRef := inodeRef((uint64(dr.startBlock) << 16) | uint64(offset))
 	return string(name), typ, inoRef, nil
@@ -132,12 +136,16 @@ func (dr *dirReader) ReadDir(n int) ([]fs.DirEntry, error) {
 		ename, typ, inoR, err := dr.nextfull()
 		if err != nil {
 			if err == io.EOF {
+				if n > 0 && len(res) == 0 {
+					// as required by fs.ReadDirFile
+					return nil, io.EOF
+				}
 				return res, nil
 			}
 			return res, err
 		}
 
-		res = append(res, &direntry{ename, typ, inoR, dr.sb})
+		res = append(res, &direntry{ename, typ, inoR, dr.lastIno, dr.sb})
 		if n > 0 && len(res) >= n {
 			return res, nil
 		}
@@ -163,12 +171,10 @@ func (de *direntry) Type() fs.FileMode {
 
 func (de *direntry) Info() (fs.FileInfo, error) {
 	// found
-	found, err := de.sb.GetInodeRef(de.inoR)
+	found, err := de.sb.loadInode(de.ino, de.inoR)
 	if err != nil {
 		return nil, err
 	}
-	// cache
-	de.sb.setInodeRefCache(found.Ino, de.inoR)
 	// append
 	return &fileinfo{name: de.name, ino: found}, nil
 }
@@ -0,0 +1,58 @@
+package squashfs
+
+import "io"
+
+// DefaultEmbeddedScan is the number of 4kB aligned offsets OpenEmbedded will
+// check for a squashfs superblock, which covers the first 256MB of data.
+const DefaultEmbeddedScan = 65536
+
+// OpenEmbedded locates a squashfs image stored inside a larger file of the
+// given size (for example appended to an executable) and opens it. Only
+// offsets aligned to 4kB are checked, as is customary for squashfs images.
+func OpenEmbedded(r io.ReaderAt, size int64, options ...Option) (*Superblock, error) {
+	offset, err := FindEmbedded(r, size, DefaultEmbeddedScan)
+	if err != nil {
+		return nil, err
+	}
+	return NewAt(r, offset, options...)
+}
+
+// FindEmbedded returns the offset of the first valid squashfs superblock found
+// on a 4kB boundary, checking at most maxCandidates offsets. ErrInvalidFile is
+// returned if no image could be found.
+func FindEmbedded(r io.ReaderAt, size int64, maxCandidates int) (int64, error) {
+	head := make([]byte, SuperblockSize)
+
+	for n := 0; n < maxCandidates; n++ {
+		offset := int64(n) * 4096
+		if offset+SuperblockSize > size {
+			break
+		}
+
+		_, err := r.ReadAt(head, offset)
+		if err != nil {
+			return 0, err
+		}
+
+		switch string(head[:4]) {
+		case "hsqs", "sqsh":
+		default:
+			continue
+		}
+
+		// validate the superblock to avoid false positives
+		sb := &Superblock{}
+		if sb.UnmarshalBinary(head) != nil {
+			continue
+		}
+		if sb.VMajor != 4 || sb.VMinor != 0 {
+			continue
+		}
+		if sb.BytesUsed > uint64(size-offset) {
+			continue
+		}
+		return offset, nil
+	}
+
+	return 0, ErrInvalidFile
+}
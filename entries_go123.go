@@ -0,0 +1,50 @@
+//go:build go1.23
+
+package squashfs
+
+import (
+	"io"
+	"io/fs"
+	"iter"
+)
+
+// Entries returns an iterator over the entries of a directory. Unlike
+// ReadDir, entries are read one at a time as the iteration progresses, so
+// stopping early avoids reading the rest of the directory.
+func (sb *Superblock) Entries(name string) iter.Seq2[fs.DirEntry, error] {
+	return func(yield func(fs.DirEntry, error) bool) {
+		if !fs.ValidPath(name) {
+			yield(nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid})
+			return
+		}
+
+		ino, err := sb.FindInode(name, true)
+		if err != nil {
+			yield(nil, &fs.PathError{Op: "readdir", Path: name, Err: err})
+			return
+		}
+		if !ino.IsDir() {
+			yield(nil, &fs.PathError{Op: "readdir", Path: name, Err: ErrNotDirectory})
+			return
+		}
+
+		dr, err := sb.dirReader(ino, nil)
+		if err != nil {
+			yield(nil, &fs.PathError{Op: "readdir", Path: name, Err: err})
+			return
+		}
+
+		for {
+			ename, typ, inoR, err := dr.nextfull()
+			if err != nil {
+				if err != io.EOF {
+					yield(nil, &fs.PathError{Op: "readdir", Path: name, Err: err})
+				}
+				return
+			}
+			if !yield(&direntry{ename, typ, inoR, dr.lastIno, sb}, nil) {
+				return
+			}
+		}
+	}
+}
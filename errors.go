@@ -9,4 +9,10 @@ var (
 	ErrInodeNotExported = errors.New("unknown squashfs inode and no NFS export table")
 	ErrNotDirectory     = errors.New("Not a directory")
 	ErrTooManySymlinks  = errors.New("Too many levels of symbolic links")
+	ErrSymlinkInPath    = errors.New("symbolic link found in path")
+	ErrSymlinkTooLong   = errors.New("symlink target too long")
+	ErrTooDeep          = errors.New("maximum directory depth exceeded")
+	ErrDirectoryLoop    = errors.New("directory loop detected")
+	ErrTruncatedArchive = errors.New("squashfs archive is truncated")
+	ErrWrongCompression = errors.New("compressed block does not match the archive's compression")
 )
@@ -29,6 +29,7 @@ type fileinfo struct {
 // Ensure File respects fs.File & others
 var _ fs.File = (*File)(nil)
 var _ io.ReaderAt = (*File)(nil)
+var _ io.WriterTo = (*File)(nil)
 
 var _ fs.ReadDirFile = (*FileDir)(nil)
 
@@ -58,6 +59,52 @@ func (f *File) Sys() any {
 	return f.ino
 }
 
+// WriteTo writes the file's contents from the current position to w, decoding
+// each block only once. This is used by io.Copy and is faster than reading the
+// file in small chunks.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if pos >= int64(f.ino.Size) {
+		return 0, nil
+	}
+
+	block := int(pos / int64(f.ino.sb.BlockSize))
+	offset := int(pos % int64(f.ino.sb.BlockSize))
+	var n int64
+
+	for pos+n < int64(f.ino.Size) {
+		f.ino.readahead(block, block)
+		buf, err := f.ino.readBlock(block)
+		if err != nil {
+			f.Seek(pos+n, io.SeekStart)
+			return n, err
+		}
+		if offset > 0 {
+			buf = buf[offset:]
+			offset = 0
+		}
+		if len(buf) == 0 {
+			// should not happen unless the image is corrupted
+			f.Seek(pos+n, io.SeekStart)
+			return n, io.ErrUnexpectedEOF
+		}
+
+		l, err := w.Write(buf)
+		n += int64(l)
+		if err != nil {
+			f.Seek(pos+n, io.SeekStart)
+			return n, err
+		}
+		block += 1
+	}
+
+	_, err = f.Seek(pos+n, io.SeekStart)
+	return n, err
+}
+
 // Close actually does nothing and exists to comply with fs.File
 func (f *File) Close() error {
 	return nil
@@ -90,12 +137,16 @@ func (d *FileDir) ReadDir(n int) ([]fs.DirEntry, error) {
 	if d.r == nil {
 		dr, err := d.ino.sb.dirReader(d.ino, nil)
 		if err != nil {
-			return nil, err
+			return nil, &fs.PathError{Op: "readdirent", Path: d.name, Err: err}
 		}
 		d.r = dr
 	}
 
-	return d.r.ReadDir(n)
+	res, err := d.r.ReadDir(n)
+	if err != nil && err != io.EOF {
+		return res, &fs.PathError{Op: "readdirent", Path: d.name, Err: err}
+	}
+	return res, err
 }
 
 // (fileinfo)
@@ -126,7 +177,10 @@ func (fi *fileinfo) IsDir() bool {
 	return fi.ino.IsDir()
 }
 
-// Sys returns the *Inode object matching this file
+// Sys returns the *Inode object matching this file. This is guaranteed for all
+// fs.FileInfo returned by this package, and gives access to details such as
+// the inode number (Ino), link count (NLink), ownership (Uid, Gid) and device
+// numbers (Rdev). Files sharing the same Ino are hard links.
 func (fi *fileinfo) Sys() any {
 	return fi.ino
 }
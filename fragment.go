@@ -0,0 +1,57 @@
+package squashfs
+
+import "encoding/binary"
+
+// fragEntry is an entry of the fragment table
+type fragEntry struct {
+	start uint64
+	size  uint32
+}
+
+// readFragment returns the decompressed fragment block for a given fragment index
+func (sb *Superblock) readFragment(idx uint32) ([]byte, error) {
+	ent, err := sb.getFragEntry(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	return sb.readDataBlock(ent.start, ent.size)
+}
+
+func (sb *Superblock) getFragEntry(idx uint32) (fragEntry, error) {
+	sb.fragIdxL.RLock()
+	ent, ok := sb.fragIdx[idx]
+	sb.fragIdxL.RUnlock()
+	if ok {
+		return ent, nil
+	}
+
+	// read table offset
+	sub := int64(idx) / 512 * 8
+	blInfo := make([]byte, 8)
+	err := sb.readAt(blInfo, int64(sb.FragTableStart)+sub, "fragment table")
+	if err != nil {
+		return ent, err
+	}
+
+	// read table
+	t, err := sb.newTableReader(int64(sb.order.Uint64(blInfo)), int(idx%512)*16)
+	if err != nil {
+		return ent, err
+	}
+
+	err = binary.Read(t, sb.order, &ent.start)
+	if err != nil {
+		return ent, err
+	}
+	err = binary.Read(t, sb.order, &ent.size)
+	if err != nil {
+		return ent, err
+	}
+
+	sb.fragIdxL.Lock()
+	sb.fragIdx[idx] = ent
+	sb.fragIdxL.Unlock()
+
+	return ent, nil
+}
@@ -0,0 +1,153 @@
+package squashfs
+
+import (
+	"io"
+	"io/fs"
+	"path"
+)
+
+// GetPath returns the path of a given inode, using the same inode numbering
+// as GetInode (the root directory is always inode 1). Directories are
+// resolved by following their parent inodes, other files require scanning the
+// tree. If an inode is reachable through multiple paths (hard links), only one
+// of them is returned.
+func (sb *Superblock) GetPath(ino uint64) (string, error) {
+	if ino == 1 {
+		return ".", nil
+	}
+	if ino == sb.rootInoN {
+		// we reverse
+		ino = 1
+	}
+	return sb.getPath(uint32(ino), make(map[uint32]bool))
+}
+
+// getPath returns the path for a given actual inode number. seen holds the
+// directories already visited while following parent inodes, to detect loops.
+func (sb *Superblock) getPath(ino uint32, seen map[uint32]bool) (string, error) {
+	if uint64(ino) == sb.rootInoN {
+		return ".", nil
+	}
+
+	sb.pathIdxL.RLock()
+	res, ok := sb.pathIdx[ino]
+	sb.pathIdxL.RUnlock()
+	if ok {
+		return res, nil
+	}
+
+	res, err := sb.resolvePath(ino, seen)
+	if err != nil {
+		return "", err
+	}
+
+	sb.pathIdxL.Lock()
+	sb.pathIdx[ino] = res
+	sb.pathIdxL.Unlock()
+
+	return res, nil
+}
+
+func (sb *Superblock) resolvePath(ino uint32, seen map[uint32]bool) (string, error) {
+	i, err := sb.getInodeByNum(ino)
+	if err != nil || !i.IsDir() {
+		// only directories know their parent, scan the whole tree
+		return sb.scanPath(ino)
+	}
+
+	if seen[ino] {
+		return "", ErrDirectoryLoop
+	}
+	seen[ino] = true
+	if sb.tooDeep(len(seen)) {
+		return "", ErrTooDeep
+	}
+
+	parentPath, err := sb.getPath(i.ParentIno, seen)
+	if err != nil {
+		return "", err
+	}
+	parent, err := sb.getInodeByNum(i.ParentIno)
+	if err != nil {
+		return "", err
+	}
+
+	dr, err := sb.dirReader(parent, nil)
+	if err != nil {
+		return "", err
+	}
+	for {
+		ename, _, _, err := dr.nextfull()
+		if err != nil {
+			if err == io.EOF {
+				return "", fs.ErrNotExist
+			}
+			return "", err
+		}
+		if dr.lastIno == ino {
+			return path.Join(parentPath, ename), nil
+		}
+	}
+}
+
+// getInodeByNum returns an inode from its actual inode number, taking care of
+// the root inode swap done by GetInode
+func (sb *Superblock) getInodeByNum(ino uint32) (*Inode, error) {
+	switch uint64(ino) {
+	case sb.rootInoN:
+		return sb.rootIno, nil
+	case 1:
+		return sb.GetInode(sb.rootInoN)
+	default:
+		return sb.GetInode(uint64(ino))
+	}
+}
+
+// scanPath walks the whole tree looking for a given inode number
+func (sb *Superblock) scanPath(ino uint32) (string, error) {
+	type dirItem struct {
+		name  string
+		ino   *Inode
+		depth int
+	}
+	queue := []dirItem{{".", sb.rootIno, 0}}
+	seen := map[uint32]bool{sb.rootIno.Ino: true}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		dr, err := sb.dirReader(cur.ino, nil)
+		if err != nil {
+			return "", err
+		}
+		for {
+			ename, typ, inoR, err := dr.nextfull()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return "", err
+			}
+			if dr.lastIno == ino {
+				return path.Join(cur.name, ename), nil
+			}
+			if typ.IsDir() {
+				if seen[dr.lastIno] {
+					// directories can't be hard linked
+					return "", ErrDirectoryLoop
+				}
+				seen[dr.lastIno] = true
+				if sb.tooDeep(cur.depth + 1) {
+					return "", ErrTooDeep
+				}
+				child, err := sb.loadInode(dr.lastIno, inoR)
+				if err != nil {
+					return "", err
+				}
+				queue = append(queue, dirItem{path.Join(cur.name, ename), child, cur.depth + 1})
+			}
+		}
+	}
+	return "", fs.ErrNotExist
+}
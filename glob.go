@@ -0,0 +1,113 @@
+package squashfs
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+var _ fs.GlobFS = (*Superblock)(nil)
+
+// Glob implements fs.GlobFS. Only the directories needed to match the pattern
+// are read, and when a pattern element starts with a literal prefix the
+// directory index is used to skip directly to the matching entries.
+//
+// As with fs.Glob, file system errors are ignored and the only possible
+// returned error is path.ErrBadPattern.
+func (sb *Superblock) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if !hasMeta(pattern) {
+		if _, err := sb.Stat(pattern); err != nil {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	cur := []string{"."}
+	elems := strings.Split(pattern, "/")
+
+	for n, elem := range elems {
+		var next []string
+
+		for _, dir := range cur {
+			if hasMeta(elem) {
+				next = append(next, sb.globDir(dir, elem)...)
+				continue
+			}
+			p := path.Join(dir, elem)
+			if n == len(elems)-1 {
+				// final element, make sure it exists
+				if _, err := sb.Stat(p); err != nil {
+					continue
+				}
+			}
+			next = append(next, p)
+		}
+
+		if len(next) == 0 {
+			return nil, nil
+		}
+		cur = next
+	}
+
+	return cur, nil
+}
+
+// globDir returns the entries of dir matching pattern
+func (sb *Superblock) globDir(dir, pattern string) []string {
+	ino, err := sb.FindInode(dir, true)
+	if err != nil || !ino.IsDir() {
+		return nil
+	}
+
+	// literal prefix of the pattern, if any
+	prefix := pattern
+	if pos := strings.IndexAny(pattern, `*?[\`); pos != -1 {
+		prefix = pattern[:pos]
+	}
+
+	var di *DirIndexEntry
+	if prefix != "" {
+		for _, t := range ino.DirIndex {
+			if strings.Compare(prefix, t.Name) < 0 {
+				break
+			}
+			di = t
+		}
+	}
+
+	dr, err := sb.dirReader(ino, di)
+	if err != nil {
+		return nil
+	}
+
+	var res []string
+	for {
+		ename, _, err := dr.next()
+		if err != nil {
+			if err != io.EOF {
+				return nil
+			}
+			return res
+		}
+		if !strings.HasPrefix(ename, prefix) {
+			if ename > prefix {
+				// entries are sorted, we will not find any more matches
+				return res
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, ename); ok {
+			res = append(res, path.Join(dir, ename))
+		}
+	}
+}
+
+// hasMeta reports whether path contains any of the magic characters
+// recognized by path.Match.
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
@@ -1,10 +1,14 @@
 module github.com/KarpelesLab/squashfs
 
-go 1.18
+go 1.20
+
+require (
+	github.com/hanwen/go-fuse/v2 v2.1.0
+	github.com/pierrec/lz4/v4 v4.1.30
+	github.com/ulikunitz/xz v0.5.10
+)
 
 require (
-	github.com/hanwen/go-fuse/v2 v2.1.0 // indirect
 	github.com/klauspost/compress v1.15.12 // indirect
-	github.com/ulikunitz/xz v0.5.10 // indirect
 	golang.org/x/sys v0.0.0-20180830151530-49385e6e1522 // indirect
 )
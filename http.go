@@ -0,0 +1,43 @@
+package squashfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// ServeFile replies to the request with the contents of the named file using
+// http.ServeContent, which handles Range requests, If-Modified-Since and
+// Content-Type detection based on the file's name and contents. The
+// modification time is the one stored in the inode.
+func (sb *Superblock) ServeFile(w http.ResponseWriter, r *http.Request, name string) {
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		http.Error(w, "400 bad request", http.StatusBadRequest)
+		return
+	}
+
+	ino, err := sb.FindInode(name, true)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrNotDirectory) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+		return
+	}
+	if ino.Type.Basic() != FileType {
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return
+	}
+
+	f := ino.OpenFile(name).(io.ReadSeeker)
+	http.ServeContent(w, r, path.Base(name), time.Unix(int64(ino.ModTime), 0), f)
+}
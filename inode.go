@@ -14,6 +14,12 @@ type Inode struct {
 	// refcnt is first value to get guaranteed 64bits alignment, if not sync/atomic will panic
 	refcnt uint64 // for fuse
 
+	// readahead state, protected by sb.raL, see readahead.go
+	raLast int  // last block read + 1
+	raNext int  // next block to be loaded by the prefetch worker
+	raUpto int  // blocks before this one have been scheduled
+	raBusy bool // a prefetch worker is running
+
 	sb *Superblock
 
 	Type    Type
@@ -32,6 +38,7 @@ type Inode struct {
 	IdxCount   uint16 // index count for advanced directories
 	XattrIdx   uint32 // xattr table index (if relevant)
 	Sparse     uint64
+	DevNum     uint32 // device number for block/char devices, see Rdev()
 
 	// fragment
 	FragBlock uint32
@@ -53,33 +60,52 @@ func (sb *Superblock) GetInode(ino uint64) (*Inode, error) {
 		ino = 1
 	}
 
+	// check inode cache
+	if found, ok := sb.inoCache.get(uint32(ino)); ok {
+		return found, nil
+	}
+
 	// check index cache
 	inoR, ok := sb.getInodeRefCache(uint32(ino))
 	if ok {
 		return sb.GetInodeRef(inoR)
 	}
 
+	inoR, err := sb.exportInodeRef(ino)
+	if err != nil {
+		return nil, err
+	}
+
+	// cache value
+	sb.setInodeRefCache(uint32(ino), inoR)
+
+	return sb.GetInodeRef(inoR)
+}
+
+// exportInodeRef looks up the reference of an inode in the export table.
+// ExportTableStart points to a list of pointers to metadata blocks, each
+// holding 1024 inode refs, not to the first metadata block itself.
+func (sb *Superblock) exportInodeRef(ino uint64) (inodeRef, error) {
 	// we do not use the flags here, but only see if the table is present. If absent it will be all f's
 	//if !sb.Flags.Has(EXPORTABLE) {
 	if sb.ExportTableStart == ^uint64(0) {
-		return nil, ErrInodeNotExported
+		return 0, ErrInodeNotExported
 	}
 
-	// load the export table
-	tr, err := sb.newTableReader(int64(sb.ExportTableStart), int(8*(ino-1)))
+	blInfo := make([]byte, 8)
+	err := sb.readAt(blInfo, int64(sb.ExportTableStart)+int64((ino-1)/1024*8), "export table")
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	err = binary.Read(tr, sb.order, &inoR)
+	tr, err := sb.newTableReader(int64(sb.order.Uint64(blInfo)), int(8*((ino-1)%1024)))
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	// cache value
-	sb.setInodeRefCache(uint32(ino), inoR)
-
-	return sb.GetInodeRef(inoR)
+	var inoR inodeRef
+	err = binary.Read(tr, sb.order, &inoR)
+	return inoR, err
 }
 
 func (sb *Superblock) GetInodeRef(inor inodeRef) (*Inode, error) {
@@ -88,7 +114,7 @@ func (sb *Superblock) GetInodeRef(inor inodeRef) (*Inode, error) {
 		return nil, err
 	}
 
-	ino := &Inode{sb: sb}
+	ino := &Inode{sb: sb, XattrIdx: 0xffffffff}
 
 	// read inode info
 	err = binary.Read(r, sb.order, &ino.Type)
@@ -219,6 +245,9 @@ func (sb *Superblock) GetInodeRef(inor inodeRef) (*Inode, error) {
 		}
 		//log.Printf("squashfs: read extended directory success, parent=%d indexes=%d size=%d", ino.ParentIno, ino.IdxCount, ino.Size)
 	case 2: // Basic file
+		// basic files have no hard links, only extended files store nlink
+		ino.NLink = 1
+
 		var u32 uint32
 		err = binary.Read(r, sb.order, &u32)
 		if err != nil {
@@ -242,7 +271,7 @@ func (sb *Superblock) GetInodeRef(inor inodeRef) (*Inode, error) {
 		ino.Size = uint64(u32)
 
 		// try to find out how many block_sizes entries
-		blocks := int(ino.Size / uint64(sb.BlockSize))
+		blocks := ino.Size / uint64(sb.BlockSize)
 		if ino.FragBlock == 0xffffffff {
 			// file does not end in a fragment
 			if ino.Size%uint64(sb.BlockSize) != 0 {
@@ -251,21 +280,9 @@ func (sb *Superblock) GetInodeRef(inor inodeRef) (*Inode, error) {
 		}
 		//log.Printf("estimated %d blocks", blocks)
 
-		ino.Blocks = make([]uint32, blocks)
-		ino.BlocksOfft = make([]uint64, blocks)
-
-		offt := uint64(0)
-
-		// read blocks
-		for i := 0; i < blocks; i += 1 {
-			err = binary.Read(r, sb.order, &u32)
-			if err != nil {
-				return nil, err
-			}
-
-			ino.Blocks[i] = u32
-			ino.BlocksOfft[i] = offt
-			offt += uint64(u32) & 0xfffff // 1MB-1, since max block size is 1MB
+		err = ino.readBlockList(r, blocks)
+		if err != nil {
+			return nil, err
 		}
 
 		if ino.FragBlock != 0xffffffff {
@@ -309,7 +326,7 @@ func (sb *Superblock) GetInodeRef(inor inodeRef) (*Inode, error) {
 		}
 
 		// try to find out how many block_sizes entries
-		blocks := int(ino.Size / uint64(sb.BlockSize))
+		blocks := ino.Size / uint64(sb.BlockSize)
 		if ino.FragBlock == 0xffffffff {
 			// file does not end in a fragment
 			if ino.Size%uint64(sb.BlockSize) != 0 {
@@ -318,22 +335,9 @@ func (sb *Superblock) GetInodeRef(inor inodeRef) (*Inode, error) {
 		}
 		//log.Printf("estimated %d blocks", blocks)
 
-		ino.Blocks = make([]uint32, blocks)
-		ino.BlocksOfft = make([]uint64, blocks)
-		var u32 uint32
-
-		offt := uint64(0)
-
-		// read blocks
-		for i := 0; i < blocks; i += 1 {
-			err = binary.Read(r, sb.order, &u32)
-			if err != nil {
-				return nil, err
-			}
-
-			ino.Blocks[i] = u32
-			ino.BlocksOfft[i] = offt
-			offt += uint64(u32) & 0xfffff // 1MB-1, since max block size is 1MB
+		err = ino.readBlockList(r, blocks)
+		if err != nil {
+			return nil, err
 		}
 
 		if ino.FragBlock != 0xffffffff {
@@ -342,7 +346,7 @@ func (sb *Superblock) GetInodeRef(inor inodeRef) (*Inode, error) {
 		}
 
 		//log.Printf("squashfs: read extended file success, sparse=%d size=%d fragblock=%x", ino.Sparse, ino.Size, ino.FragBlock)
-	case 3: // basic symlink
+	case 3, 10: // basic/extended symlink
 		err = binary.Read(r, sb.order, &ino.NLink)
 		if err != nil {
 			return nil, err
@@ -355,9 +359,9 @@ func (sb *Superblock) GetInodeRef(inor inodeRef) (*Inode, error) {
 			return nil, err
 		}
 
-		if u32 > 4096 {
+		if int64(u32) > int64(sb.maxSymLen) {
 			// why is symlink length even stored as u32 ?
-			return nil, errors.New("symlink target too long")
+			return nil, ErrSymlinkTooLong
 		}
 		ino.Size = uint64(u32)
 
@@ -369,12 +373,58 @@ func (sb *Superblock) GetInodeRef(inor inodeRef) (*Inode, error) {
 		}
 		ino.SymTarget = buf
 
+		if ino.Type == 10 {
+			// extended symlink has a xattr index after the target
+			err = binary.Read(r, sb.order, &ino.XattrIdx)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		//log.Printf("squashfs: read symlink to %s", ino.SymTarget)
+	case 4, 5: // basic block/char device
+		err = binary.Read(r, sb.order, &ino.NLink)
+		if err != nil {
+			return nil, err
+		}
+		err = binary.Read(r, sb.order, &ino.DevNum)
+		if err != nil {
+			return nil, err
+		}
+	case 11, 12: // extended block/char device
+		err = binary.Read(r, sb.order, &ino.NLink)
+		if err != nil {
+			return nil, err
+		}
+		err = binary.Read(r, sb.order, &ino.DevNum)
+		if err != nil {
+			return nil, err
+		}
+		err = binary.Read(r, sb.order, &ino.XattrIdx)
+		if err != nil {
+			return nil, err
+		}
+	case 6, 7: // basic fifo/socket
+		err = binary.Read(r, sb.order, &ino.NLink)
+		if err != nil {
+			return nil, err
+		}
+	case 13, 14: // extended fifo/socket
+		err = binary.Read(r, sb.order, &ino.NLink)
+		if err != nil {
+			return nil, err
+		}
+		err = binary.Read(r, sb.order, &ino.XattrIdx)
+		if err != nil {
+			return nil, err
+		}
 	default:
 		log.Printf("squashfs: unsupported inode type %d", ino.Type)
 		return ino, nil
 	}
 
+	sb.inoCache.add(ino)
+
 	return ino, nil
 }
 
@@ -397,85 +447,14 @@ func (i *Inode) ReadAt(p []byte, off int64) (int, error) {
 		offset := int(off % int64(i.sb.BlockSize))
 		n := 0
 
-		for {
-			var buf []byte
-
-			// read block
-			if i.Blocks[block] == 0xffffffff {
-				// this is a fragment, need to decode fragment
-				//log.Printf("frag table offset=%d", i.sb.FragTableStart)
-
-				// read table offset
-				sub := int64(i.FragBlock) / 512 * 8
-				blInfo := make([]byte, 8)
-				_, err := i.sb.fs.ReadAt(blInfo, int64(i.sb.FragTableStart)+sub)
-				if err != nil {
-					return n, err
-				}
-
-				// read table
-				t, err := i.sb.newTableReader(int64(i.sb.order.Uint64(blInfo)), int(i.FragBlock%512)*16)
-				if err != nil {
-					return n, err
-				}
-
-				//log.Printf("fragment blinfo=%v", blInfo)
-				var start uint64
-				var size uint32
-				err = binary.Read(t, i.sb.order, &start)
-				if err != nil {
-					return n, err
-				}
-				err = binary.Read(t, i.sb.order, &size)
-				if err != nil {
-					return n, err
-				}
-
-				//log.Printf("fragment at %d:%d => start=0x%x (size=0x%x) len=%d", i.FragBlock, i.FragOfft, start, size, len(p))
-
-				if size&0x1000000 == 0x1000000 {
-					// no compression
-					buf = make([]byte, size&(0x1000000-1))
-					_, err = i.sb.fs.ReadAt(buf, int64(start))
-					if err != nil {
-						return n, err
-					}
-				} else {
-					// read fragment
-					buf = make([]byte, size)
-					_, err = i.sb.fs.ReadAt(buf, int64(start))
-					if err != nil {
-						return n, err
-					}
-
-					// decompress
-					buf, err = i.sb.Comp.decompress(buf)
-					if err != nil {
-						return n, err
-					}
-				}
-
-				if i.FragOfft != 0 {
-					buf = buf[i.FragOfft:]
-				}
-			} else if i.Blocks[block] == 0 {
-				// this part of the file contains only zeroes
-				buf = make([]byte, i.sb.BlockSize)
-			} else {
-				buf = make([]byte, i.Blocks[block]&0xfffff)
-				_, err := i.sb.fs.ReadAt(buf, int64(i.StartBlock+i.BlocksOfft[block]))
-				if err != nil {
-					return n, err
-				}
+		if len(p) > 0 {
+			i.readahead(block, int((off+int64(len(p))-1)/int64(i.sb.BlockSize)))
+		}
 
-				// check for compression
-				if i.Blocks[block]&0x1000000 == 0 {
-					// compressed
-					buf, err = i.sb.Comp.decompress(buf)
-					if err != nil {
-						return n, err
-					}
-				}
+		for {
+			buf, err := i.readBlock(block)
+			if err != nil {
+				return n, err
 			}
 
 			// check offset
@@ -502,6 +481,82 @@ func (i *Inode) ReadAt(p []byte, off int64) (int, error) {
 	return 0, fs.ErrInvalid
 }
 
+// maxBlockListPrealloc caps the number of block list entries allocated ahead
+// of reading them, as the count is derived from the on-disk file size.
+const maxBlockListPrealloc = 4096
+
+// readBlockList reads the block_sizes list of a regular file inode. A
+// corrupted file size makes the count huge, so entries are appended as they
+// are read and the list stops growing when the inode table runs out.
+func (i *Inode) readBlockList(r io.Reader, blocks uint64) error {
+	prealloc := blocks
+	if prealloc > maxBlockListPrealloc {
+		prealloc = maxBlockListPrealloc
+	}
+	i.Blocks = make([]uint32, 0, prealloc)
+	i.BlocksOfft = make([]uint64, 0, prealloc)
+
+	var u32 uint32
+	offt := uint64(0)
+
+	for n := uint64(0); n < blocks; n += 1 {
+		err := binary.Read(r, i.sb.order, &u32)
+		if err != nil {
+			return err
+		}
+
+		i.Blocks = append(i.Blocks, u32)
+		i.BlocksOfft = append(i.BlocksOfft, offt)
+		offt += uint64(u32) & 0xfffff // 1MB-1, since max block size is 1MB
+	}
+	return nil
+}
+
+// readBlock returns the decompressed data of a given block of a regular file,
+// truncated to the file size if it is the last block. If the image is
+// corrupted and the block is missing or shorter than expected,
+// io.ErrUnexpectedEOF is returned.
+func (i *Inode) readBlock(block int) ([]byte, error) {
+	if block < 0 || block >= len(i.Blocks) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var buf []byte
+
+	if i.Blocks[block] == 0xffffffff {
+		// this is a fragment, need to decode fragment
+		var err error
+		buf, err = i.sb.readFragment(i.FragBlock)
+		if err != nil {
+			return nil, err
+		}
+
+		if uint64(i.FragOfft) > uint64(len(buf)) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		buf = buf[i.FragOfft:]
+	} else if i.Blocks[block] == 0 {
+		// this part of the file contains only zeroes
+		buf = make([]byte, i.sb.BlockSize)
+	} else {
+		var err error
+		buf, err = i.sb.readDataBlock(i.StartBlock+i.BlocksOfft[block], i.Blocks[block])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// do not return data past the end of the file (fragments may contain data for other files)
+	remain := i.Size - uint64(block)*uint64(i.sb.BlockSize)
+	if uint64(len(buf)) > remain {
+		buf = buf[:remain]
+	} else if uint64(len(buf)) < remain && len(buf) < int(i.sb.BlockSize) {
+		// only the last block of a file may be shorter than the block size
+		return nil, io.ErrUnexpectedEOF
+	}
+	return buf, nil
+}
+
 // lookupRelativeInode finds the given inode in the directory
 func (i *Inode) lookupRelativeInode(name string) (*Inode, error) {
 	// TODO: handle indexes
@@ -535,14 +590,7 @@ func (i *Inode) lookupRelativeInode(name string) (*Inode, error) {
 
 			if name == ename {
 				// found, load the inode from its ref
-				found, err := i.sb.GetInodeRef(inoR)
-				if err != nil {
-					return nil, err
-				}
-				// cache info
-				i.sb.setInodeRefCache(found.Ino, inoR)
-				// return
-				return found, nil
+				return i.sb.loadInode(dr.lastIno, inoR)
 			}
 		}
 	}
@@ -572,6 +620,14 @@ func (i *Inode) Readlink() ([]byte, error) {
 	return nil, fs.ErrInvalid
 }
 
+// Rdev returns the major and minor device numbers of a block or char device
+// inode. The values are stored using the linux new_encode_dev() format.
+func (i *Inode) Rdev() (uint32, uint32) {
+	major := (i.DevNum & 0xfff00) >> 8
+	minor := (i.DevNum & 0xff) | ((i.DevNum >> 12) & 0xfff00)
+	return major, minor
+}
+
 // AddRef atomatically increments the inode's refcount and returns the new value. This is mainly useful when
 // using fuse and can be safely ignored.
 func (i *Inode) AddRef(count uint64) uint64 {
@@ -586,7 +642,7 @@ func (i *Inode) DelRef(count uint64) uint64 {
 
 // GetUid returns inode's owner uid, or zero if an error happens
 func (i *Inode) GetUid() uint32 {
-	if len(i.sb.idTable) >= int(i.UidIdx) {
+	if int(i.UidIdx) < len(i.sb.idTable) {
 		return i.sb.idTable[i.UidIdx]
 	}
 	return 0
@@ -594,8 +650,20 @@ func (i *Inode) GetUid() uint32 {
 
 // GetGid returns inode's group id, or zero if an error happens
 func (i *Inode) GetGid() uint32 {
-	if len(i.sb.idTable) >= int(i.GidIdx) {
+	if int(i.GidIdx) < len(i.sb.idTable) {
 		return i.sb.idTable[i.GidIdx]
 	}
 	return 0
 }
+
+// Uid returns inode's owner uid, same as GetUid. Together with Gid, this
+// allows tools copying files from any fs.FS to find ownership information by
+// checking if FileInfo.Sys() implements interface{ Uid() uint32; Gid() uint32 }.
+func (i *Inode) Uid() uint32 {
+	return i.GetUid()
+}
+
+// Gid returns inode's group id, same as GetGid
+func (i *Inode) Gid() uint32 {
+	return i.GetGid()
+}
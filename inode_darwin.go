@@ -8,10 +8,16 @@ import (
 
 func (i *Inode) FillAttr(attr *fuse.Attr) error {
 	attr.Size = i.Size
-	attr.Blocks = uint64(len(i.Blocks)) + 1
+	attr.Blocks = i.diskBlocks()
 	attr.Mode = modeToUnix(i.Mode())
 	attr.Nlink = i.NLink // 1 required
-	attr.Rdev = 1
+	attr.Rdev = 0
+	switch i.Type.Basic() {
+	case BlockDevType, CharDevType:
+		// darwin's makedev(), with 8 bits for the major
+		major, minor := i.Rdev()
+		attr.Rdev = major<<24 | minor&0xffffff
+	}
 	attr.Atime = uint64(i.ModTime)
 	attr.Mtime = uint64(i.ModTime)
 	attr.Ctime = uint64(i.ModTime)
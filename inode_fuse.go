@@ -4,9 +4,12 @@ package squashfs
 
 import (
 	"context"
+	"errors"
 	"io"
 	"io/fs"
 	"log"
+	"sort"
+	"syscall"
 	"time"
 
 	"github.com/hanwen/go-fuse/v2/fuse"
@@ -34,6 +37,67 @@ func (i *Inode) OpenDir() (uint32, error) {
 	return 0, fs.ErrInvalid
 }
 
+// GetXAttr copies the value of an extended attribute into dest and returns its
+// size. As with getxattr(2), if dest is too small the required size is returned
+// along with ERANGE, and ENOATTR is returned if there is no such attribute.
+func (i *Inode) GetXAttr(attr string, dest []byte) (uint32, error) {
+	val, err := i.GetXattr(attr)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, syscall.Errno(fuse.ENOATTR)
+		}
+		return 0, err
+	}
+	if len(dest) < len(val) {
+		return uint32(len(val)), syscall.ERANGE
+	}
+	return uint32(copy(dest, val)), nil
+}
+
+// ListXAttr copies the names of all extended attributes of the inode into dest
+// as a list of NUL terminated strings, and returns its size. As with
+// listxattr(2), if dest is too small the required size is returned along with
+// ERANGE.
+func (i *Inode) ListXAttr(dest []byte) (uint32, error) {
+	attrs, err := i.ListXattrs()
+	if err != nil {
+		return 0, err
+	}
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var res []byte
+	for _, name := range names {
+		res = append(res, name...)
+		res = append(res, 0)
+	}
+	if len(dest) < len(res) {
+		return uint32(len(res)), syscall.ERANGE
+	}
+	return uint32(copy(dest, res)), nil
+}
+
+// diskBlocks returns the space used by the data of the inode in 512 bytes
+// units, as expected in st_blocks. The tail end of a file stored in a fragment
+// is counted at its uncompressed size, as fragments are shared.
+func (i *Inode) diskBlocks() uint64 {
+	var size uint64
+	for n, blk := range i.Blocks {
+		switch blk {
+		case 0:
+			// sparse
+		case 0xffffffff:
+			size += i.Size - uint64(n)*uint64(i.sb.BlockSize)
+		default:
+			size += uint64(blk & (0x1000000 - 1))
+		}
+	}
+	return (size + 511) / 512
+}
+
 // publicInodeNum returns a inode number suitable for use in mounts sharing multiple squashfs images. The root is
 // required to be inode 1, so in case it is not the case we swap the root inode number with whatever inode it was
 func (i *Inode) publicInodeNum() uint64 {
@@ -120,14 +184,12 @@ func (i *Inode) ReadDir(input *fuse.ReadIn, out *fuse.DirEntryList, plus bool) e
 			}
 
 			// make inode ref
-			ino, err := i.sb.GetInodeRef(inoR)
+			ino, err := i.sb.loadInode(dr.lastIno, inoR)
 			if err != nil {
-				log.Printf("failed to load inode: %s")
+				log.Printf("failed to load inode: %s", err)
 				return err
 			}
 
-			i.sb.setInodeRefCache(ino.Ino, inoR)
-
 			if !plus {
 				if !out.Add(0, string(name), ino.publicInodeNum(), uint32(ino.Perm)) {
 					return nil
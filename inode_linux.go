@@ -8,19 +8,24 @@ import (
 
 func (i *Inode) FillAttr(attr *fuse.Attr) error {
 	attr.Size = i.Size
-	attr.Blocks = uint64(len(i.Blocks)) + 1
+	attr.Blocks = i.diskBlocks()
 	attr.Mode = modeToUnix(i.Mode())
 	attr.Nlink = i.NLink // 1 required
-	attr.Rdev = 1
+	attr.Rdev = 0
+	switch i.Type.Basic() {
+	case BlockDevType, CharDevType:
+		// DevNum uses new_encode_dev(), same as fuse
+		attr.Rdev = i.DevNum
+	}
 	attr.Blksize = i.sb.BlockSize
 	attr.Atime = uint64(i.ModTime)
 	attr.Mtime = uint64(i.ModTime)
 	attr.Ctime = uint64(i.ModTime)
 	// fill uid/gid based on idtable
-	if len(i.sb.idTable) >= int(i.UidIdx) {
+	if int(i.UidIdx) < len(i.sb.idTable) {
 		attr.Owner.Uid = i.sb.idTable[i.UidIdx]
 	}
-	if len(i.sb.idTable) >= int(i.GidIdx) {
+	if int(i.GidIdx) < len(i.sb.idTable) {
 		attr.Owner.Gid = i.sb.idTable[i.GidIdx]
 	}
 	return nil
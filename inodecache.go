@@ -0,0 +1,77 @@
+package squashfs
+
+import (
+	"container/list"
+	"sync"
+)
+
+// defaultInodeCacheSize is the default number of parsed inodes kept in memory per superblock
+const defaultInodeCacheSize = 4096
+
+// inodeCache is a LRU cache of parsed inodes keyed by inode number. Since
+// images are read-only, entries never need to be invalidated.
+type inodeCache struct {
+	lk    sync.Mutex
+	max   int
+	lru   *list.List
+	items map[uint32]*list.Element
+}
+
+func newInodeCache(max int) *inodeCache {
+	return &inodeCache{
+		max:   max,
+		lru:   list.New(),
+		items: make(map[uint32]*list.Element),
+	}
+}
+
+func (c *inodeCache) get(num uint32) (*Inode, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e, ok := c.items[num]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*Inode), true
+}
+
+func (c *inodeCache) add(ino *Inode) {
+	if c.max <= 0 {
+		// cache disabled
+		return
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if e, ok := c.items[ino.Ino]; ok {
+		// already added by someone else
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	c.items[ino.Ino] = c.lru.PushFront(ino)
+
+	for c.lru.Len() > c.max {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.items, e.Value.(*Inode).Ino)
+	}
+}
+
+// loadInode returns the inode with the given number, from the cache if
+// possible or by parsing it from its reference.
+func (sb *Superblock) loadInode(num uint32, inoR inodeRef) (*Inode, error) {
+	if ino, ok := sb.inoCache.get(num); ok {
+		return ino, nil
+	}
+
+	ino, err := sb.GetInodeRef(inoR)
+	if err != nil {
+		return nil, err
+	}
+	sb.setInodeRefCache(ino.Ino, inoR)
+	return ino, nil
+}
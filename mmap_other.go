@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package squashfs
+
+// OpenMmap is the same as Open on platforms where mmap is not supported.
+func OpenMmap(file string, options ...Option) (*Superblock, error) {
+	return Open(file, options...)
+}
@@ -0,0 +1,97 @@
+//go:build linux || darwin
+
+package squashfs
+
+import (
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+)
+
+// mmapReader is a io.ReaderAt over a memory mapped file. Reads hold the lock
+// so the file cannot be unmapped while they copy data out of it.
+type mmapReader struct {
+	data []byte
+	lk   sync.RWMutex
+}
+
+// OpenMmap is similar to Open, but maps the file in memory instead of reading
+// it with system calls, which is faster for random accesses on large images.
+// The file is unmapped when Close() is called on the superblock or by the
+// garbage collector, after which the superblock must not be used anymore.
+//
+// On platforms where mmap is not supported, this is the same as Open.
+func OpenMmap(file string, options ...Option) (*Superblock, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // the mapping stays valid after the file is closed
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() < SuperblockSize {
+		return nil, ErrInvalidFile
+	}
+	if st.Size() > math.MaxInt {
+		// cannot be mapped in the address space
+		return nil, &os.PathError{Op: "mmap", Path: file, Err: syscall.EFBIG}
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(st.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: file, Err: err}
+	}
+
+	m := &mmapReader{data: data}
+	sb, err := New(m, options...)
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	sb.clos = m
+
+	clean := func(sb *Superblock) {
+		sb.Close()
+	}
+	runtime.SetFinalizer(sb, clean)
+	return sb, nil
+}
+
+func (m *mmapReader) ReadAt(p []byte, off int64) (int, error) {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	if m.data == nil {
+		return 0, fs.ErrClosed
+	}
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *mmapReader) Close() error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if m.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.data)
+	m.data = nil
+	return err
+}
@@ -1,5 +1,7 @@
 package squashfs
 
+import "path"
+
 type Option func(sb *Superblock) error
 
 func InodeOffset(inoOfft uint64) Option {
@@ -8,3 +10,79 @@ func InodeOffset(inoOfft uint64) Option {
 		return nil
 	}
 }
+
+// WithCacheSize sets the maximum amount of decompressed data, in bytes, that
+// will be kept in memory to speed up repeated reads of the same blocks. The
+// default is 8MB, and a value of 0 disables caching.
+func WithCacheSize(size int) Option {
+	return func(sb *Superblock) error {
+		sb.blockCache = newBlockCache(size)
+		return nil
+	}
+}
+
+// WithInodeCacheSize sets the maximum number of parsed inodes kept in memory
+// to speed up repeated lookups of the same files. The default is 4096, and a
+// value of 0 disables caching.
+func WithInodeCacheSize(n int) Option {
+	return func(sb *Superblock) error {
+		sb.inoCache = newInodeCache(n)
+		return nil
+	}
+}
+
+// WithReadahead enables prefetching of the next blocks of a file in the
+// background when it is being read sequentially. Prefetched blocks are stored
+// in the block cache, which needs to be large enough to hold them.
+func WithReadahead(blocks int) Option {
+	return func(sb *Superblock) error {
+		sb.readahead = blocks
+		return nil
+	}
+}
+
+// WithMaxDepth sets the maximum directory nesting that will be followed when
+// looking up paths, walking the tree or resolving the path of an inode, past
+// which ErrTooDeep is returned. This protects against crafted images with
+// directory loops. The default is 1024, and a value of 0 disables the limit.
+func WithMaxDepth(depth int) Option {
+	return func(sb *Superblock) error {
+		sb.maxDepth = depth
+		return nil
+	}
+}
+
+// WithMaxSymlinkLen sets the maximum length of symlink targets, in bytes.
+// Symlinks with a longer target fail to load with ErrSymlinkTooLong, which
+// protects against large allocations caused by corrupted inodes. The default
+// is 4096, which is PATH_MAX on linux.
+func WithMaxSymlinkLen(n int) Option {
+	return func(sb *Superblock) error {
+		sb.maxSymLen = n
+		return nil
+	}
+}
+
+// WithSymlinkRoot allows absolute symlinks to be followed, by treating prefix
+// as the location of the archive root. For example with a root filesystem
+// image, WithSymlinkRoot("/") makes a symlink to /usr/bin/sh resolve to
+// usr/bin/sh inside the archive. Absolute symlinks pointing outside of prefix
+// are still rejected, as they are by default when this option isn't used.
+func WithSymlinkRoot(prefix string) Option {
+	return func(sb *Superblock) error {
+		sb.symlinkRoot = path.Clean("/" + prefix)
+		return nil
+	}
+}
+
+// WithDecompressor sets a decompressor to be used for this superblock only,
+// taking precedence over decompressors registered with RegisterDecompressor.
+func WithDecompressor(method Compression, dcomp Decompressor) Option {
+	return func(sb *Superblock) error {
+		if sb.decompressHandler == nil {
+			sb.decompressHandler = make(map[Compression]Decompressor)
+		}
+		sb.decompressHandler[method] = dcomp
+		return nil
+	}
+}
@@ -0,0 +1,73 @@
+package squashfs
+
+import "sync/atomic"
+
+// readahead is called by ReadAt with the first and last blocks of a read, and
+// if the read continues the previous one, schedules the following blocks to
+// be loaded in the block cache in the background. Each inode has at most one
+// prefetch worker, which picks up blocks as they get scheduled.
+func (i *Inode) readahead(first, last int) {
+	count := i.sb.readahead
+	if count <= 0 {
+		return
+	}
+
+	i.sb.raL.Lock()
+	defer i.sb.raL.Unlock()
+
+	prev := i.raLast
+	i.raLast = last + 1
+	if prev == 0 || (first != prev-1 && first != prev) {
+		// not a sequential read
+		i.raUpto = 0
+		i.raNext = 0
+		return
+	}
+
+	from := last + 1
+	if i.raUpto > from {
+		// already scheduled
+		from = i.raUpto
+	}
+	to := last + 1 + count
+	if to > len(i.Blocks) {
+		to = len(i.Blocks)
+	}
+	if from >= to {
+		return
+	}
+	i.raUpto = to
+	if i.raNext <= last {
+		// blocks up to last have been read already
+		i.raNext = last + 1
+	}
+
+	if !i.raBusy {
+		i.raBusy = true
+		go i.prefetch()
+	}
+}
+
+// prefetch loads scheduled blocks in the block cache until it catches up with
+// readahead or the superblock is closed
+func (i *Inode) prefetch() {
+	for {
+		i.sb.raL.Lock()
+		if i.raNext >= i.raUpto || atomic.LoadInt32(&i.sb.closed) != 0 {
+			i.raBusy = false
+			i.sb.raL.Unlock()
+			return
+		}
+		block := i.raNext
+		i.raNext += 1
+		i.sb.raL.Unlock()
+
+		switch i.Blocks[block] {
+		case 0, 0xffffffff:
+			// sparse block or fragment
+			continue
+		}
+		// errors are ignored here, and will be returned when the block is actually read
+		i.sb.readDataBlock(i.StartBlock+i.BlocksOfft[block], i.Blocks[block])
+	}
+}
@@ -0,0 +1,95 @@
+package squashfs
+
+import (
+	"io"
+	"io/fs"
+)
+
+// fileReader reads a regular file sequentially, decoding each block once
+type fileReader struct {
+	ino   *Inode
+	block int    // next block to decode
+	buf   []byte // remaining data of the current block
+	pos   uint64
+}
+
+var _ io.ReadCloser = (*fileReader)(nil)
+var _ io.WriterTo = (*fileReader)(nil)
+
+// Reader returns a io.ReadCloser reading the contents of a regular file from
+// start to end. Unlike files returned by OpenFile it cannot seek, but it has
+// less overhead for one-shot sequential reads.
+func (i *Inode) Reader() io.ReadCloser {
+	return &fileReader{ino: i}
+}
+
+// next loads the next block of the file in buf
+func (r *fileReader) next() error {
+	if r.ino == nil {
+		return fs.ErrClosed
+	}
+	switch r.ino.Type {
+	case 2, 9:
+	default:
+		return fs.ErrInvalid
+	}
+	if r.pos >= r.ino.Size {
+		return io.EOF
+	}
+
+	r.ino.readahead(r.block, r.block)
+	buf, err := r.ino.readBlock(r.block)
+	if err != nil {
+		return err
+	}
+	if len(buf) == 0 {
+		// should not happen unless the image is corrupted
+		return io.ErrUnexpectedEOF
+	}
+	r.buf = buf
+	r.block += 1
+	r.pos += uint64(len(buf))
+	return nil
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// WriteTo writes the remaining data of the file to w, and is used by io.Copy
+func (r *fileReader) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+
+	for {
+		if len(r.buf) == 0 {
+			if err := r.next(); err != nil {
+				if err == io.EOF {
+					return n, nil
+				}
+				return n, err
+			}
+		}
+
+		l, err := w.Write(r.buf)
+		n += int64(l)
+		r.buf = r.buf[l:]
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close releases the reader, further reads will fail
+func (r *fileReader) Close() error {
+	r.ino = nil
+	r.buf = nil
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build go1.25
+
+package squashfs
+
+import "io/fs"
+
+var _ fs.ReadLinkFS = (*Superblock)(nil)
@@ -0,0 +1,36 @@
+package squashfs
+
+import (
+	"io"
+	"sync"
+)
+
+// readSeekerAt adapts an io.ReadSeeker into an io.ReaderAt
+type readSeekerAt struct {
+	rs io.ReadSeeker
+	lk sync.Mutex
+}
+
+// NewFromReadSeeker returns a new instance of superblock reading the image
+// from an io.ReadSeeker, for when an io.ReaderAt isn't available. Since
+// reads require seeking first, they are serialized and concurrent accesses
+// to the returned superblock will not run in parallel.
+func NewFromReadSeeker(rs io.ReadSeeker, options ...Option) (*Superblock, error) {
+	return New(&readSeekerAt{rs: rs}, options...)
+}
+
+func (r *readSeekerAt) ReadAt(p []byte, off int64) (int, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	_, err := r.rs.Seek(off, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		// io.ReaderAt returns io.EOF on short reads at the end of the data
+		err = io.EOF
+	}
+	return n, err
+}
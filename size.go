@@ -0,0 +1,71 @@
+package squashfs
+
+import "io/fs"
+
+// UncompressedSize returns the total size of all the regular files in the
+// archive, counting files with multiple hard links only once. The result is
+// computed on the first call using the export table if present, or by walking
+// the whole tree otherwise, and cached for subsequent calls.
+func (sb *Superblock) UncompressedSize() (uint64, error) {
+	sb.sizeL.Lock()
+	defer sb.sizeL.Unlock()
+
+	if sb.sizeDone {
+		return sb.size, nil
+	}
+
+	var total uint64
+
+	if sb.ExportTableStart != ^uint64(0) {
+		// every inode appears once in the export table
+		for n := uint64(1); n <= uint64(sb.InodeCnt); n++ {
+			ino, err := sb.GetInode(n)
+			if err != nil {
+				return 0, err
+			}
+			if ino.Type.Basic() == FileType {
+				total += ino.Size
+			}
+		}
+	} else {
+		seen := make(map[uint32]bool)
+		err := sb.Walk(".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			ino := info.Sys().(*Inode)
+			if !seen[ino.Ino] {
+				seen[ino.Ino] = true
+				total += ino.Size
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	sb.size = total
+	sb.sizeDone = true
+	return total, nil
+}
+
+// CompressionRatio returns the ratio between the uncompressed size of the
+// files in the archive and the size of the archive itself.
+func (sb *Superblock) CompressionRatio() (float64, error) {
+	size, err := sb.UncompressedSize()
+	if err != nil {
+		return 0, err
+	}
+	if sb.BytesUsed == 0 {
+		return 0, ErrInvalidSuper
+	}
+	return float64(size) / float64(sb.BytesUsed), nil
+}
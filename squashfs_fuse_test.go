@@ -0,0 +1,192 @@
+//go:build fuse
+
+package squashfs_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/KarpelesLab/squashfs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestFuseXAttr(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/special.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/special.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	found := 0
+	err = sqfs.Walk(".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		ino := info.Sys().(*squashfs.Inode)
+		attrs, err := ino.ListXattrs()
+		if err != nil {
+			return err
+		}
+
+		// query the size first, as the kernel does
+		sz, err := ino.ListXAttr(nil)
+		if len(attrs) > 0 && !errors.Is(err, syscall.ERANGE) {
+			t.Errorf("%s: listxattr with empty buffer returned unexpected err=%v", name, err)
+		}
+		list := make([]byte, sz)
+		n, err := ino.ListXAttr(list)
+		if err != nil || n != sz {
+			t.Errorf("%s: listxattr failed: %v", name, err)
+			return nil
+		}
+
+		found += len(attrs)
+		names := bytes.Split(list, []byte{0})
+		if len(names[len(names)-1]) != 0 || len(names)-1 != len(attrs) {
+			t.Errorf("%s: listxattr returned %q for %d attributes", name, list, len(attrs))
+			return nil
+		}
+		for _, attr := range names[:len(names)-1] {
+			val := make([]byte, 65536)
+			n, err := ino.GetXAttr(string(attr), val)
+			if err != nil {
+				t.Errorf("%s: getxattr %s failed: %s", name, attr, err)
+			} else if !bytes.Equal(val[:n], attrs[string(attr)]) {
+				t.Errorf("%s: getxattr %s returned the wrong value", name, attr)
+			}
+		}
+
+		_, err = ino.GetXAttr("user.does.not.exist", nil)
+		if !errors.Is(err, syscall.Errno(fuse.ENOATTR)) {
+			t.Errorf("%s: getxattr of missing attribute returned unexpected err=%v", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("failed to walk testdata/special.squashfs: %s", err)
+	}
+	if found != 13 {
+		t.Errorf("found %d xattrs, expected 13", found)
+	}
+}
+
+func TestFuseSymlinkAttr(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/azusa_symlinks.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/azusa_symlinks.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	err = sqfs.Walk(".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		ino := info.Sys().(*squashfs.Inode)
+		target, err := ino.Readlink()
+		if err != nil {
+			t.Errorf("%s: readlink failed: %s", name, err)
+			return nil
+		}
+
+		// the kernel uses the size as the length of the link target
+		var attr fuse.Attr
+		ino.FillAttr(&attr)
+		if attr.Size != uint64(len(target)) {
+			t.Errorf("%s: symlink size is %d, target %q has length %d", name, attr.Size, target, len(target))
+		}
+		if attr.Mode&syscall.S_IFMT != syscall.S_IFLNK {
+			t.Errorf("%s: mode %o is not a symlink", name, attr.Mode)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("failed to walk testdata/azusa_symlinks.squashfs: %s", err)
+	}
+}
+
+func TestFuseRdev(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/special.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/special.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	ino, err := sqfs.FindInode("xattr/file", false)
+	if err != nil {
+		t.Fatalf("failed to find xattr/file: %s", err)
+	}
+
+	var attr fuse.Attr
+	ino.FillAttr(&attr)
+	if attr.Rdev != 0 {
+		t.Errorf("regular file has rdev %#x", attr.Rdev)
+	}
+
+	dev, err := sqfs.FindInode("dev/ttyS1", false)
+	if err != nil {
+		t.Fatalf("failed to find dev/ttyS1: %s", err)
+	}
+	dev.FillAttr(&attr)
+	expect := uint32(0x441) // linux's new_encode_dev(), as used by fuse
+	if runtime.GOOS == "darwin" {
+		expect = 4<<24 | 65
+	}
+	if attr.Rdev != expect {
+		t.Errorf("char device has rdev %#x, expected %#x", attr.Rdev, expect)
+	}
+}
+
+func TestFuseBlocks(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	err = sqfs.Walk(".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		ino := info.Sys().(*squashfs.Inode)
+		blocks, err := ino.BlockInfo()
+		if err != nil {
+			return err
+		}
+		var size uint64
+		for _, blk := range blocks {
+			switch {
+			case blk.Sparse:
+			case blk.Fragment:
+				size += uint64(blk.Size)
+			default:
+				size += uint64(blk.CompressedSize)
+			}
+		}
+
+		var attr fuse.Attr
+		ino.FillAttr(&attr)
+		if attr.Blocks != (size+511)/512 {
+			t.Errorf("%s: %d blocks reported for %d bytes on disk", name, attr.Blocks, size)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("failed to walk testdata/zlib-dev.squashfs: %s", err)
+	}
+}
@@ -0,0 +1,64 @@
+//go:build go1.23
+
+package squashfs_test
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/KarpelesLab/squashfs"
+)
+
+func TestEntries(t *testing.T) {
+	f, err := os.Open("testdata/bigdir.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/bigdir.squashfs: %s", err)
+	}
+	defer f.Close()
+
+	open := func() (*squashfs.Superblock, *countingReaderAt) {
+		r := &countingReaderAt{r: f}
+		sqfs, err := squashfs.New(r)
+		if err != nil {
+			t.Fatalf("failed to open testdata/bigdir.squashfs: %s", err)
+		}
+		atomic.StoreInt64(&r.cnt, 0)
+		return sqfs, r
+	}
+
+	sqfs, all := open()
+	n := 0
+	for de, err := range sqfs.Entries("bigdir") {
+		if err != nil {
+			t.Fatalf("failed to iterate bigdir: %s", err)
+		}
+		if de.Name() == "" {
+			t.Errorf("entry %d has no name", n)
+		}
+		n += 1
+	}
+	ents, err := sqfs.ReadDir("bigdir")
+	if err != nil {
+		t.Fatalf("failed to read bigdir: %s", err)
+	}
+	if n != len(ents) {
+		t.Errorf("iterated over %d entries, expected %d", n, len(ents))
+	}
+
+	sqfs, first := open()
+	for de, err := range sqfs.Entries("bigdir") {
+		if err != nil {
+			t.Fatalf("failed to iterate bigdir: %s", err)
+		}
+		if de.Name() != ents[0].Name() {
+			t.Errorf("first entry is %s, expected %s", de.Name(), ents[0].Name())
+		}
+		break
+	}
+
+	// stopping after the first entry must not read the whole directory
+	if first.cnt >= all.cnt {
+		t.Errorf("stopping after the first entry read %d bytes, full iteration %d", first.cnt, all.cnt)
+	}
+}
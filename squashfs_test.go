@@ -1,15 +1,33 @@
 package squashfs_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/zlib"
+	"context"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/KarpelesLab/squashfs"
+	"github.com/ulikunitz/xz"
 )
 
 // testdata/zlib-dev.squashfs
@@ -94,6 +112,78 @@ func TestSquashfs(t *testing.T) {
 	}
 }
 
+// files found in the lz4, lzma and xz testdata images, with their hashes
+var compressionSamples = map[string]string{
+	"doc/words.txt":  "a5b45ccdea607e46c034be35e13f0515aa069bd2e67b84888e6f8960b6fcb43f",
+	"doc/random.bin": "c0372042eb42ec80ca0f3b4d20853e59a9ec162e7485acc05aafd57195573877",
+	"doc/small.txt":  "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447",
+	"doc/empty":      "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+}
+
+// testCompressionImage reads all of an image compressed with a given method
+func testCompressionImage(t *testing.T, name string, comp squashfs.Compression) *squashfs.Superblock {
+	sqfs, err := squashfs.Open(name)
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", name, err)
+	}
+	t.Cleanup(func() { sqfs.Close() })
+
+	if sqfs.Comp != comp {
+		t.Errorf("%s: compression is %s, expected %s", name, sqfs.Comp, comp)
+	}
+
+	for file, hash := range compressionSamples {
+		data, err := fs.ReadFile(sqfs, file)
+		if err != nil {
+			t.Errorf("%s: failed to read %s: %s", name, file, err)
+		} else if s256(data) != hash {
+			t.Errorf("%s: invalid hash for %s", name, file)
+		}
+	}
+
+	// go through all metadata blocks
+	cnt := 0
+	err = fs.WalkDir(sqfs, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		cnt += 1
+		if d.Type().IsRegular() {
+			_, err = fs.ReadFile(sqfs, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Errorf("%s: failed to walk: %s", name, err)
+	} else if cnt != 408 {
+		t.Errorf("%s: found %d files, expected 408", name, cnt)
+	}
+	return sqfs
+}
+
+func TestLZ4(t *testing.T) {
+	sqfs := testCompressionImage(t, "testdata/lz4.squashfs", squashfs.LZ4)
+
+	// compressed in high compression mode
+	opts, ok := sqfs.CompressorOptions.(*squashfs.LZ4Options)
+	if !ok || opts.Flags != 1 {
+		t.Errorf("unexpected lz4 compressor options %+v", sqfs.CompressorOptions)
+	}
+}
+
+func TestXZ(t *testing.T) {
+	sqfs := testCompressionImage(t, "testdata/xz.squashfs", squashfs.XZ)
+
+	opts, ok := sqfs.CompressorOptions.(*squashfs.XZOptions)
+	if !ok || opts.DictionarySize != 8192 || opts.ExecutableFilters != 0 {
+		t.Errorf("unexpected xz compressor options %+v", sqfs.CompressorOptions)
+	}
+}
+
+func TestLZMA(t *testing.T) {
+	testCompressionImage(t, "testdata/lzma.squashfs", squashfs.LZMA)
+}
+
 func TestBigdir(t *testing.T) {
 	sqfs, err := squashfs.Open("testdata/bigdir.squashfs")
 	if err != nil {
@@ -150,3 +240,2261 @@ func TestBigdir(t *testing.T) {
 		t.Errorf("failed to find inode full/lib64/libLLVMIRReader.a: %s", err)
 	}
 }
+
+func TestSymlinks(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/azusa_symlinks.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/azusa_symlinks.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	// every symlink, basic or extended, must have a target
+	err = fs.WalkDir(sqfs, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		ino := info.Sys().(*squashfs.Inode)
+		if !ino.Type.IsSymlink() {
+			t.Errorf("%s: inode type %d is not a symlink", name, ino.Type)
+		}
+		target, err := ino.Readlink()
+		if err != nil || len(target) == 0 {
+			t.Errorf("%s: failed to read symlink (type %d): %v", name, ino.Type, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("failed to walk testdata/azusa_symlinks.squashfs: %s", err)
+	}
+}
+
+func TestFindInodeNoFollow(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	// lib is a symlink to a directory
+	_, err = sqfs.FindInodeNoFollow("lib/libz.a")
+	if !errors.Is(err, squashfs.ErrSymlinkInPath) {
+		t.Errorf("lib/libz.a returned unexpected err=%v", err)
+	}
+	_, err = sqfs.FindInodeNoFollow("lib/../pkgconfig")
+	if !errors.Is(err, squashfs.ErrSymlinkInPath) {
+		t.Errorf("lib/../pkgconfig returned unexpected err=%v", err)
+	}
+
+	// the symlink itself can be looked up
+	ino, err := sqfs.FindInodeNoFollow("lib")
+	if err != nil {
+		t.Fatalf("failed to find lib: %s", err)
+	}
+	if !ino.Type.IsSymlink() {
+		t.Errorf("lib: expected a symlink, got type %d", ino.Type)
+	}
+
+	// and so can its target
+	target, err := sqfs.ReadLink("lib")
+	if err != nil {
+		t.Fatalf("failed to readlink lib: %s", err)
+	}
+	ino, err = sqfs.FindInodeNoFollow(target + "/libz.a")
+	if err != nil {
+		t.Errorf("failed to find %s/libz.a: %s", target, err)
+	} else if ino.Ino != 6 {
+		t.Errorf("invalid inode found for %s/libz.a", target)
+	}
+
+	_, err = sqfs.FindInodeNoFollow("pkgconfig/zlib.pc/foo")
+	if !errors.Is(err, squashfs.ErrNotDirectory) {
+		t.Errorf("pkgconfig/zlib.pc/foo returned unexpected err=%v", err)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	f, err := os.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer f.Close()
+
+	sqfs, err := squashfs.New(f)
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+
+	// tables are stored after the data, so cutting the image anywhere will lose some
+	for _, size := range []int64{50, int64(sqfs.InodeTableStart) + 10, int64(sqfs.IdTableStart)} {
+		_, err = squashfs.New(io.NewSectionReader(f, 0, size))
+		if !errors.Is(err, squashfs.ErrTruncatedArchive) {
+			t.Errorf("opening image truncated at %d bytes returned unexpected err=%v", size, err)
+		}
+	}
+
+	// not a squashfs image at all
+	_, err = squashfs.New(strings.NewReader("hello"))
+	if !errors.Is(err, squashfs.ErrInvalidFile) {
+		t.Errorf("opening short non-squashfs file returned unexpected err=%v", err)
+	}
+}
+
+// countingReaderAt counts the bytes read from the underlying image
+type countingReaderAt struct {
+	r   io.ReaderAt
+	cnt int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	atomic.AddInt64(&c.cnt, int64(n))
+	return n, err
+}
+
+// countDecompress returns an option counting the gzip blocks decompressed by a
+// superblock in cnt
+func countDecompress(cnt *int64) squashfs.Option {
+	dec := squashfs.MakeDecompressorErr(zlib.NewReader)
+	return squashfs.WithDecompressor(squashfs.GZip, func(buf []byte) ([]byte, error) {
+		atomic.AddInt64(cnt, 1)
+		return dec(buf)
+	})
+}
+
+// inodeLocation returns the decompressed metadata block holding the inode of
+// name and the offset of the inode in it, as found in the listing of its
+// parent directory
+func inodeLocation(t *testing.T, sqfs *squashfs.Superblock, name string) ([]byte, int) {
+	t.Helper()
+	parent, err := sqfs.FindInode(path.Dir(name), false)
+	if err != nil {
+		t.Fatalf("failed to find %s: %s", path.Dir(name), err)
+	}
+
+	// directory sizes include 3 bytes for the . and .. entries
+	var listing []byte
+	end := int(parent.Offset) + int(parent.Size) - 3
+	for next := int64(sqfs.DirTableStart + parent.StartBlock); len(listing) < end; {
+		var buf []byte
+		buf, next, err = sqfs.ReadMetadataBlock(next)
+		if err != nil {
+			t.Fatalf("failed to read listing of %s: %s", path.Dir(name), err)
+		}
+		listing = append(listing, buf...)
+	}
+	listing = listing[parent.Offset:end]
+
+	// headers are followed by count+1 entries using the same inode block
+	for len(listing) >= 12 {
+		count := binary.LittleEndian.Uint32(listing)
+		start := binary.LittleEndian.Uint32(listing[4:])
+		listing = listing[12:]
+		for i := uint32(0); i <= count; i++ {
+			offset := binary.LittleEndian.Uint16(listing)
+			nameLen := int(binary.LittleEndian.Uint16(listing[6:])) + 1
+			entry := string(listing[8 : 8+nameLen])
+			listing = listing[8+nameLen:]
+			if entry != path.Base(name) {
+				continue
+			}
+			blk, _, err := sqfs.ReadMetadataBlock(int64(sqfs.InodeTableStart) + int64(start))
+			if err != nil {
+				t.Fatalf("failed to read inode block of %s: %s", name, err)
+			}
+			return blk, int(offset)
+		}
+	}
+	t.Fatalf("%s not found in the listing of %s", path.Base(name), path.Dir(name))
+	return nil, 0
+}
+
+// patchedReaderAt overlays a modified superblock over an image
+type patchedReaderAt struct {
+	r    io.ReaderAt
+	head []byte
+}
+
+func (p *patchedReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n, err := p.r.ReadAt(b, off)
+	if off < int64(len(p.head)) {
+		copy(b, p.head[off:])
+	}
+	return n, err
+}
+
+func TestInvalidTables(t *testing.T) {
+	f, err := os.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer f.Close()
+
+	head := make([]byte, squashfs.SuperblockSize)
+	if _, err := f.ReadAt(head, 0); err != nil {
+		t.Fatalf("failed to read superblock: %s", err)
+	}
+	sqfs, err := squashfs.New(f)
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	order := binary.ByteOrder(binary.LittleEndian)
+	if string(head[:4]) == "sqsh" {
+		order = binary.BigEndian
+	}
+
+	for _, tc := range []struct {
+		name  string
+		offt  int // offset of the value in the superblock
+		value uint64
+		err   error
+	}{
+		{"inode table past directory table", 64, sqfs.DirTableStart + 1, squashfs.ErrInvalidSuper},
+		{"inode table inside superblock", 64, 0, squashfs.ErrInvalidSuper},
+		{"directory table past end", 72, sqfs.BytesUsed + 4096, squashfs.ErrInvalidSuper},
+		{"id table inside inode table", 48, sqfs.DirTableStart - 1, squashfs.ErrInvalidSuper},
+		{"id table inside superblock", 48, 8, squashfs.ErrInvalidSuper},
+		{"id table past end", 48, sqfs.BytesUsed, squashfs.ErrInvalidSuper},
+		{"xattr table past end", 56, sqfs.BytesUsed + 1, squashfs.ErrInvalidSuper},
+		// tables are not required to be in the order mksquashfs writes them
+		{"fragment table after id table", 80, sqfs.IdTableStart + 1, nil},
+	} {
+		patched := append([]byte{}, head...)
+		order.PutUint64(patched[tc.offt:], tc.value)
+
+		_, err = squashfs.New(&patchedReaderAt{r: f, head: patched})
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: unexpected err=%v", tc.name, err)
+		}
+	}
+}
+
+func TestServeFile(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	data, err := fs.ReadFile(sqfs, "include/zlib.h")
+	if err != nil {
+		t.Fatalf("failed to read include/zlib.h: %s", err)
+	}
+
+	req := httptest.NewRequest("GET", "/include/zlib.h", nil)
+	req.Header.Set("Range", "bytes=100-199")
+	rec := httptest.NewRecorder()
+	sqfs.ServeFile(rec, req, req.URL.Path)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Errorf("range request returned status %d, expected 206", rec.Code)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), data[100:200]) {
+		t.Errorf("range request returned invalid data")
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	// modification time comes from the inode
+	lastMod := rec.Header().Get("Last-Modified")
+	req = httptest.NewRequest("GET", "/include/zlib.h", nil)
+	req.Header.Set("If-Modified-Since", lastMod)
+	rec = httptest.NewRecorder()
+	sqfs.ServeFile(rec, req, req.URL.Path)
+
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional request returned status %d, expected 304", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	sqfs.ServeFile(rec, httptest.NewRequest("GET", "/missing", nil), "/missing")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("request for missing file returned status %d, expected 404", rec.Code)
+	}
+}
+
+func TestSymlinkRoot(t *testing.T) {
+	open := func(options ...squashfs.Option) *squashfs.Superblock {
+		sqfs, err := squashfs.Open("testdata/special.squashfs", options...)
+		if err != nil {
+			t.Fatalf("failed to open testdata/special.squashfs: %s", err)
+		}
+		t.Cleanup(func() { sqfs.Close() })
+		return sqfs
+	}
+	sqfs := open()
+	sh, err := sqfs.FindInode("usr/bin/sh", false)
+	if err != nil {
+		t.Fatalf("failed to find usr/bin/sh: %s", err)
+	}
+
+	for _, tc := range []struct {
+		root string // symlink root, none if empty
+		name string // bin/sh -> /usr/bin/sh or bin/app-sh -> /srv/app/usr/bin/sh
+		err  error  // nil if the symlink resolves to usr/bin/sh
+	}{
+		{"", "bin/sh", fs.ErrInvalid},
+		{"", "bin/app-sh", fs.ErrInvalid},
+		{"/", "bin/sh", nil},
+		{"/", "bin/app-sh", fs.ErrNotExist}, // srv/app/usr/bin/sh
+		{"/srv/app", "bin/sh", fs.ErrInvalid},
+		{"/srv/app", "bin/app-sh", nil},
+		{"srv/app/", "bin/app-sh", nil},
+	} {
+		sb := sqfs
+		if tc.root != "" {
+			sb = open(squashfs.WithSymlinkRoot(tc.root))
+		}
+		ino, err := sb.FindInode(tc.name, true)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("%s with root %q: unexpected err=%v, expected %s", tc.name, tc.root, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s with root %q: failed to resolve: %s", tc.name, tc.root, err)
+		} else if ino.Ino != sh.Ino {
+			t.Errorf("%s with root %q: resolved to inode %d, expected usr/bin/sh (%d)", tc.name, tc.root, ino.Ino, sh.Ino)
+		}
+	}
+
+	// absolute symlinks found in a real root filesystem
+	sqfs, err = squashfs.Open("testdata/azusa_symlinks.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/azusa_symlinks.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	rooted, err := squashfs.Open("testdata/azusa_symlinks.squashfs", squashfs.WithSymlinkRoot("/"))
+	if err != nil {
+		t.Fatalf("failed to open testdata/azusa_symlinks.squashfs: %s", err)
+	}
+	defer rooted.Close()
+
+	err = fs.WalkDir(sqfs, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return err
+		}
+		target, err := sqfs.ReadLink(name)
+		if err != nil || !strings.HasPrefix(target, "/") {
+			return err
+		}
+
+		// absolute symlinks are rejected by default
+		if _, err := sqfs.FindInode(name, true); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("%s -> %s: unexpected err=%v without symlink root", name, target, err)
+		}
+
+		// and resolved from the archive root otherwise
+		ino, err := rooted.FindInode(name, true)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s -> %s: unexpected err=%v with symlink root", name, target, err)
+			}
+			return nil
+		}
+		expect, err := rooted.FindInode(strings.TrimPrefix(target, "/"), true)
+		if err != nil || expect.Ino != ino.Ino {
+			t.Errorf("%s -> %s: resolved to the wrong inode", name, target)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("failed to walk testdata/azusa_symlinks.squashfs: %s", err)
+	}
+}
+
+func TestSubAtInode(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	ino, err := sqfs.FindInode("include", false)
+	if err != nil {
+		t.Fatalf("failed to find include: %s", err)
+	}
+	sub, err := sqfs.SubAtInode(ino)
+	if err != nil {
+		t.Fatalf("failed to get sub fs at include: %s", err)
+	}
+
+	if err := fstest.TestFS(sub, "zlib.h"); err != nil {
+		t.Errorf("sub fs at include: %s", err)
+	}
+
+	data, err := fs.ReadFile(sub, "zlib.h")
+	if err != nil {
+		t.Errorf("failed to read zlib.h: %s", err)
+	} else if expect, _ := fs.ReadFile(sqfs, "include/zlib.h"); !bytes.Equal(data, expect) {
+		t.Errorf("zlib.h does not match include/zlib.h")
+	}
+
+	// the parent directory is not reachable
+	_, err = sub.Open("../pkgconfig/zlib.pc")
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("open ../pkgconfig/zlib.pc returned unexpected err=%v", err)
+	}
+
+	file, err := sqfs.FindInode("include/zlib.h", false)
+	if err != nil {
+		t.Fatalf("failed to find include/zlib.h: %s", err)
+	}
+	_, err = sqfs.SubAtInode(file)
+	if !errors.Is(err, squashfs.ErrNotDirectory) {
+		t.Errorf("sub fs at a file returned unexpected err=%v", err)
+	}
+}
+
+func TestNewFromReadSeeker(t *testing.T) {
+	data, err := os.ReadFile("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to read testdata/zlib-dev.squashfs: %s", err)
+	}
+
+	// hide bytes.Reader's ReadAt method
+	rs := struct{ io.ReadSeeker }{bytes.NewReader(data)}
+
+	sqfs, err := squashfs.NewFromReadSeeker(rs)
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+
+	data, err = fs.ReadFile(sqfs, "pkgconfig/zlib.pc")
+	if err != nil {
+		t.Errorf("failed to read pkgconfig/zlib.pc: %s", err)
+	} else if s256(data) != "2bbfca2364630d3ad2bbc9d44f45fe5470236539a906e11e2072157709e54692" {
+		t.Errorf("invalid hash for pkgconfig/zlib.pc")
+	}
+}
+
+func TestDirIndex(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/bigdir.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/bigdir.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	idx, err := sqfs.DirIndex("bigdir")
+	if err != nil {
+		t.Fatalf("failed to read index of bigdir: %s", err)
+	}
+	st, err := sqfs.Stat("bigdir")
+	if err != nil {
+		t.Fatalf("failed to stat bigdir: %s", err)
+	}
+	size := st.Sys().(*squashfs.Inode).Size
+
+	// mksquashfs adds an index entry each time the directory data crosses a
+	// metadata block (8kB), at a header boundary (every 256 entries at most)
+	if len(idx) == 0 || uint64(len(idx)) > size/(8192-512)+1 {
+		t.Errorf("bigdir has %d index entries for %d bytes of directory data", len(idx), size)
+	}
+
+	for n, di := range idx {
+		if n > 0 && (di.Name <= idx[n-1].Name || di.Index <= idx[n-1].Index) {
+			t.Errorf("index entry %d (%s) is not sorted", n, di.Name)
+		}
+		if _, err := sqfs.Stat(path.Join("bigdir", di.Name)); err != nil {
+			t.Errorf("index entry %d points to a missing file: %s", n, err)
+		}
+	}
+
+	_, err = sqfs.DirIndex("bigdir/999.txt")
+	if !errors.Is(err, squashfs.ErrNotDirectory) {
+		t.Errorf("DirIndex on a file returned unexpected err=%v", err)
+	}
+}
+
+func TestReadMetadataBlock(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	data, next, err := sqfs.ReadMetadataBlock(int64(sqfs.InodeTableStart))
+	if err != nil {
+		t.Fatalf("failed to read first inode table block: %s", err)
+	}
+	if len(data) == 0 || len(data) > squashfs.MetadataBlockSize {
+		t.Errorf("invalid inode table block size %d", len(data))
+	}
+	if next <= int64(sqfs.InodeTableStart) || next > int64(sqfs.DirTableStart) {
+		t.Errorf("invalid next block offset %d", next)
+	}
+
+	// the returned data must not be shared with the reader
+	for i := range data {
+		data[i] = 0xff
+	}
+	if _, err := fs.ReadFile(sqfs, "pkgconfig/zlib.pc"); err != nil {
+		t.Errorf("failed to read pkgconfig/zlib.pc after modifying block: %s", err)
+	}
+
+	_, _, err = sqfs.ReadMetadataBlock(1 << 40)
+	if !errors.Is(err, squashfs.ErrTruncatedArchive) {
+		t.Errorf("reading past the end returned unexpected err=%v", err)
+	}
+}
+
+func TestPathError(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	for _, tc := range []struct {
+		op   string
+		name string
+		f    func(name string) error
+	}{
+		{"open", "missing", func(name string) error { _, err := sqfs.Open(name); return err }},
+		{"stat", "missing", func(name string) error { _, err := sqfs.Stat(name); return err }},
+		{"lstat", "include/missing", func(name string) error { _, err := sqfs.Lstat(name); return err }},
+		{"readdir", "missing", func(name string) error { _, err := sqfs.ReadDir(name); return err }},
+		{"readdir", "include/zlib.h", func(name string) error { _, err := sqfs.ReadDir(name); return err }},
+		{"stat", "include/zlib.h/x", func(name string) error { _, err := sqfs.Stat(name); return err }},
+		{"readfile", "missing", func(name string) error { _, err := sqfs.ReadFile(name); return err }},
+	} {
+		err := tc.f(tc.name)
+		var pe *fs.PathError
+		if !errors.As(err, &pe) {
+			t.Errorf("%s %s: error %v is not a *fs.PathError", tc.op, tc.name, err)
+			continue
+		}
+		if pe.Op != tc.op || pe.Path != tc.name {
+			t.Errorf("%s %s: unexpected PathError op=%s path=%s", tc.op, tc.name, pe.Op, pe.Path)
+		}
+	}
+}
+
+func TestUncompressedSize(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	var expect uint64
+	seen := make(map[uint32]bool)
+	err = fs.WalkDir(sqfs, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		st, err := fs.Stat(sqfs, name)
+		if err != nil {
+			return err
+		}
+		// hard links are counted once
+		if ino := st.Sys().(*squashfs.Inode); !seen[ino.Ino] {
+			seen[ino.Ino] = true
+			expect += uint64(st.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk testdata/zlib-dev.squashfs: %s", err)
+	}
+
+	size, err := sqfs.UncompressedSize()
+	if err != nil {
+		t.Fatalf("failed to compute uncompressed size: %s", err)
+	}
+	if size != expect {
+		t.Errorf("uncompressed size is %d, expected %d", size, expect)
+	}
+
+	ratio, err := sqfs.CompressionRatio()
+	if err != nil || ratio != float64(expect)/float64(sqfs.BytesUsed) {
+		t.Errorf("unexpected compression ratio %f, err=%v", ratio, err)
+	}
+}
+
+func TestGetInodeExport(t *testing.T) {
+	// every inode of a small image, from a fresh superblock so inodes are
+	// looked up in the export table rather than found in the caches
+	small, err := squashfs.Open("testdata/lz4.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/lz4.squashfs: %s", err)
+	}
+	defer small.Close()
+
+	root, err := small.GetInode(1)
+	if err != nil {
+		t.Fatalf("failed to get root inode of testdata/lz4.squashfs: %s", err)
+	}
+	for num := uint32(1); num <= small.InodeCnt; num++ {
+		// GetInode swaps the numbers of the root and of inode 1
+		expect := num
+		switch num {
+		case 1:
+			expect = root.Ino
+		case root.Ino:
+			expect = 1
+		}
+		ino, err := small.GetInode(uint64(num))
+		if err != nil {
+			t.Fatalf("failed to get inode %d of testdata/lz4.squashfs: %s", num, err)
+		} else if ino.Ino != expect {
+			t.Errorf("inode %d of testdata/lz4.squashfs returned inode %d", num, ino.Ino)
+		}
+	}
+
+	sqfs, err := squashfs.Open("testdata/bigdir.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/bigdir.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	if sqfs.ExportTableStart == ^uint64(0) {
+		t.Skipf("testdata/bigdir.squashfs has no export table")
+	}
+
+	// the export table holds 1024 inode refs per metadata block, check inodes
+	// on both sides of block boundaries
+	ents, err := sqfs.ReadDir("bigdir")
+	if err != nil {
+		t.Fatalf("failed to read bigdir: %s", err)
+	}
+	expect := make(map[uint32]string)
+	for _, de := range ents {
+		info, err := de.Info()
+		if err != nil {
+			t.Fatalf("failed to stat bigdir/%s: %s", de.Name(), err)
+		}
+		switch ino := info.Sys().(*squashfs.Inode).Ino; {
+		case ino%1024 <= 1, ino == sqfs.InodeCnt:
+			expect[ino] = de.Name()
+		}
+	}
+	if len(expect) < 4 {
+		t.Fatalf("bigdir has too few inodes past the first export block")
+	}
+
+	// fresh superblock, so inodes are not found in the caches
+	fresh, err := squashfs.Open("testdata/bigdir.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/bigdir.squashfs: %s", err)
+	}
+	defer fresh.Close()
+
+	for num, name := range expect {
+		ino, err := fresh.GetInode(uint64(num))
+		if err != nil {
+			t.Errorf("failed to get inode %d: %s", num, err)
+		} else if ino.Ino != num {
+			t.Errorf("inode %d (bigdir/%s) returned inode %d", num, name, ino.Ino)
+		}
+	}
+}
+
+func TestOpenMmap(t *testing.T) {
+	sqfs, err := squashfs.OpenMmap("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+
+	data, err := fs.ReadFile(sqfs, "pkgconfig/zlib.pc")
+	if err != nil {
+		t.Errorf("failed to read pkgconfig/zlib.pc: %s", err)
+	} else if s256(data) != "2bbfca2364630d3ad2bbc9d44f45fe5470236539a906e11e2072157709e54692" {
+		t.Errorf("invalid hash for pkgconfig/zlib.pc")
+	}
+
+	if err := sqfs.Close(); err != nil {
+		t.Errorf("failed to close: %s", err)
+	}
+	if err := sqfs.Close(); err != nil {
+		t.Errorf("second close failed: %s", err)
+	}
+}
+
+func TestMmapClose(t *testing.T) {
+	sqfs, err := squashfs.OpenMmap("testdata/lz4.squashfs", squashfs.WithCacheSize(0))
+	if err != nil {
+		t.Fatalf("failed to open testdata/lz4.squashfs: %s", err)
+	}
+
+	ino, err := sqfs.FindInode("doc/words.txt", false)
+	if err != nil {
+		t.Fatalf("failed to find doc/words.txt: %s", err)
+	}
+
+	// keep reading while the superblock gets closed
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 4096)
+			for {
+				if _, err := ino.ReadAt(buf, 0); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := sqfs.Close(); err != nil {
+		t.Errorf("failed to close: %s", err)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("read after close returned unexpected err=%v", err)
+		}
+	}
+}
+
+func benchmarkBackend(b *testing.B, open func(string, ...squashfs.Option) (*squashfs.Superblock, error)) {
+	// disable cache so each read hits the backend
+	sqfs, err := open("testdata/zlib-dev.squashfs", squashfs.WithCacheSize(0))
+	if err != nil {
+		b.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	ino, err := sqfs.FindInode("lib/libz.a", false)
+	if err != nil {
+		b.Fatalf("failed to find lib/libz.a: %s", err)
+	}
+
+	buf := make([]byte, 4096)
+	rnd := rand.New(rand.NewSource(0))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < 10000; i++ {
+			_, err := ino.ReadAt(buf, rnd.Int63n(int64(ino.Size)-int64(len(buf))))
+			if err != nil {
+				b.Fatalf("failed to read lib/libz.a: %s", err)
+			}
+		}
+	}
+}
+
+func BenchmarkRandomReadFile(b *testing.B) {
+	benchmarkBackend(b, squashfs.Open)
+}
+
+func BenchmarkRandomReadMmap(b *testing.B) {
+	benchmarkBackend(b, squashfs.OpenMmap)
+}
+
+func TestWalkContext(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/bigdir.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/bigdir.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cnt := 0
+	err = sqfs.WalkContext(ctx, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		cnt += 1
+		if cnt == 100 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled walk returned unexpected err=%v", err)
+	}
+	if cnt != 100 {
+		t.Errorf("walk visited %d entries after being cancelled", cnt-100)
+	}
+
+	_, err = sqfs.ReadFileContext(ctx, "bigdir/999.txt")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadFileContext with cancelled context returned unexpected err=%v", err)
+	}
+}
+
+func TestInodeReader(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	// lib/libz.a spans multiple blocks, zlib.pc is a fragment
+	for _, name := range []string{"lib/libz.a", "pkgconfig/zlib.pc"} {
+		expect, err := fs.ReadFile(sqfs, name)
+		if err != nil {
+			t.Errorf("failed to read %s: %s", name, err)
+			continue
+		}
+		ino, err := sqfs.FindInode(name, true)
+		if err != nil {
+			t.Errorf("failed to find %s: %s", name, err)
+			continue
+		}
+
+		// small reads, without WriteTo
+		r := ino.Reader()
+		data, err := io.ReadAll(io.LimitReader(r, int64(len(expect))+1))
+		r.Close()
+		if err != nil || !bytes.Equal(data, expect) {
+			t.Errorf("%s: data read through Reader differs from fs.ReadFile (err=%v)", name, err)
+		}
+
+		// io.Copy, using WriteTo
+		buf := &bytes.Buffer{}
+		_, err = io.Copy(buf, ino.Reader())
+		if err != nil || !bytes.Equal(buf.Bytes(), expect) {
+			t.Errorf("%s: data copied from Reader differs from fs.ReadFile (err=%v)", name, err)
+		}
+	}
+}
+
+func TestBlockInfo(t *testing.T) {
+	f, err := os.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer f.Close()
+
+	sqfs, err := squashfs.New(f)
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	if sqfs.Comp != squashfs.GZip {
+		t.Skipf("test image uses %s compression", sqfs.Comp)
+	}
+	dec := squashfs.MakeDecompressorErr(zlib.NewReader)
+
+	for _, name := range []string{"lib/libz.a", "pkgconfig/zlib.pc"} {
+		expect, err := fs.ReadFile(sqfs, name)
+		if err != nil {
+			t.Errorf("failed to read %s: %s", name, err)
+			continue
+		}
+		ino, err := sqfs.FindInode(name, true)
+		if err != nil {
+			t.Errorf("failed to find %s: %s", name, err)
+			continue
+		}
+		blocks, err := ino.BlockInfo()
+		if err != nil {
+			t.Errorf("failed to get blocks of %s: %s", name, err)
+			continue
+		}
+
+		// rebuild the file from the raw blocks
+		var res []byte
+		for _, blk := range blocks {
+			if blk.Sparse {
+				res = append(res, make([]byte, blk.Size)...)
+				continue
+			}
+			buf := make([]byte, blk.CompressedSize)
+			if _, err := f.ReadAt(buf, int64(blk.Offset)); err != nil {
+				t.Fatalf("failed to read block of %s: %s", name, err)
+			}
+			if !blk.Uncompressed {
+				buf, err = dec(buf)
+				if err != nil {
+					t.Fatalf("failed to decompress block of %s: %s", name, err)
+				}
+			}
+			if blk.Fragment {
+				buf = buf[blk.FragOffset:]
+			}
+			res = append(res, buf[:blk.Size]...)
+		}
+
+		if !bytes.Equal(res, expect) {
+			t.Errorf("%s: data rebuilt from BlockInfo differs from fs.ReadFile", name)
+		}
+	}
+}
+
+func TestExtendedSymlink(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/special.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/special.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	ino, err := sqfs.FindInode("xattr/link", false)
+	if err != nil {
+		t.Fatalf("failed to find xattr/link: %s", err)
+	}
+	if ino.Type != squashfs.XSymlinkType {
+		t.Errorf("xattr/link has type %d, expected %d", ino.Type, squashfs.XSymlinkType)
+	}
+	if string(ino.SymTarget) != "file" {
+		t.Errorf("xattr/link points to %q, expected \"file\"", ino.SymTarget)
+	}
+	if target, err := sqfs.ReadLink("xattr/link"); err != nil || target != "file" {
+		t.Errorf("ReadLink(xattr/link) = %q, err=%v", target, err)
+	}
+
+	// the symlink has the same xattrs as xattr/file, stored once
+	file, err := sqfs.FindInode("xattr/file", false)
+	if err != nil {
+		t.Fatalf("failed to find xattr/file: %s", err)
+	}
+	if ino.XattrIdx == 0xffffffff || ino.XattrIdx != file.XattrIdx {
+		t.Errorf("xattr/link has xattr index %#x, expected %#x", ino.XattrIdx, file.XattrIdx)
+	}
+	if v, err := ino.GetXattr("trusted.overlay.opaque"); err != nil || string(v) != "y" {
+		t.Errorf("getxattr of xattr/link returned %q, err=%v", v, err)
+	}
+
+	// following the symlink leads to the file
+	target, err := sqfs.FindInode("xattr/link", true)
+	if err != nil {
+		t.Errorf("failed to resolve xattr/link: %s", err)
+	} else if target.Ino != file.Ino {
+		t.Errorf("xattr/link resolved to inode %d, expected %d", target.Ino, file.Ino)
+	}
+}
+
+func TestXattr(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/special.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/special.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	expect := map[string]map[string]string{
+		".":     {},
+		"xattr": {"user.dir": "1"},
+		"xattr/file": {
+			"user.comment":           "hello world",
+			"trusted.overlay.opaque": "y",
+			"security.selinux":       "system_u:object_r:etc_t:s0\x00",
+		},
+		// user.comment has the same value as in xattr/file, and is stored out of line
+		"xattr/shared": {
+			"user.comment":   "hello world",
+			"user.mime_type": "text/plain",
+		},
+	}
+
+	for name, attrs := range expect {
+		ino, err := sqfs.FindInode(name, false)
+		if err != nil {
+			t.Errorf("failed to find %s: %s", name, err)
+			continue
+		}
+		list, err := ino.ListXattrs()
+		if err != nil {
+			t.Errorf("failed to list xattrs of %s: %s", name, err)
+			continue
+		}
+		if len(list) != len(attrs) {
+			t.Errorf("%s: got %d xattrs, expected %d", name, len(list), len(attrs))
+		}
+		for attr, value := range attrs {
+			if v, ok := list[attr]; !ok || string(v) != value {
+				t.Errorf("%s: listed %s=%q, expected %q", name, attr, v, value)
+			}
+			v, err := sqfs.GetXattr(name, attr)
+			if err != nil || string(v) != value {
+				t.Errorf("%s: getxattr %s returned %q, err=%v", name, attr, v, err)
+			}
+		}
+	}
+
+	_, err = sqfs.GetXattr("xattr/file", "user.does.not.exist")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("getxattr of missing attribute returned unexpected err=%s", err)
+	}
+}
+
+func benchmarkRandomRead(b *testing.B, options ...squashfs.Option) {
+	var decompress int64
+	options = append(options, countDecompress(&decompress))
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs", options...)
+	if err != nil {
+		b.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	ino, err := sqfs.FindInode("include/zlib.h", false)
+	if err != nil {
+		b.Fatalf("failed to find include/zlib.h: %s", err)
+	}
+
+	buf := make([]byte, 4096)
+	rnd := rand.New(rand.NewSource(0))
+	atomic.StoreInt64(&decompress, 0)
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		_, err := ino.ReadAt(buf, rnd.Int63n(int64(ino.Size)-int64(len(buf))))
+		if err != nil {
+			b.Fatalf("failed to read include/zlib.h: %s", err)
+		}
+	}
+	// with the block cache, most reads should not need to decompress
+	b.ReportMetric(float64(atomic.LoadInt64(&decompress))/float64(b.N), "decompress/op")
+}
+
+func BenchmarkRandomRead(b *testing.B) {
+	benchmarkRandomRead(b)
+}
+
+func BenchmarkRandomReadNoCache(b *testing.B) {
+	benchmarkRandomRead(b, squashfs.WithCacheSize(0))
+}
+
+func benchmarkReadAllocs(b *testing.B, options ...squashfs.Option) {
+	// disable cache so each read decompresses the data again
+	options = append(options, squashfs.WithCacheSize(0))
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs", options...)
+	if err != nil {
+		b.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	ino, err := sqfs.FindInode("lib/libz.a", false)
+	if err != nil {
+		b.Fatalf("failed to find lib/libz.a: %s", err)
+	}
+
+	buf := make([]byte, 4096)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		_, err := ino.ReadAt(buf, 0)
+		if err != nil {
+			b.Fatalf("failed to read lib/libz.a: %s", err)
+		}
+	}
+}
+
+func BenchmarkReadAllocs(b *testing.B) {
+	benchmarkReadAllocs(b)
+}
+
+func BenchmarkReadAllocsUnpooled(b *testing.B) {
+	benchmarkReadAllocs(b, squashfs.WithDecompressor(squashfs.GZip, squashfs.MakeDecompressorErr(zlib.NewReader)))
+}
+
+func BenchmarkReadFragment(b *testing.B) {
+	var decompress, frags int64
+	b.StopTimer()
+
+	for n := 0; n < b.N; n++ {
+		sqfs, err := squashfs.Open("testdata/special.squashfs", countDecompress(&decompress))
+		if err != nil {
+			b.Fatalf("failed to open testdata/special.squashfs: %s", err)
+		}
+
+		// resolve inodes first so only fragment blocks are decompressed
+		// while reading
+		var inodes []*squashfs.Inode
+		for i := 0; i < 500; i++ {
+			ino, err := sqfs.FindInode(fmt.Sprintf("small/%03d", i), false)
+			if err != nil {
+				b.Fatalf("failed to find small/%03d: %s", i, err)
+			}
+			inodes = append(inodes, ino)
+		}
+		atomic.StoreInt64(&decompress, 0)
+
+		b.StartTimer()
+		for _, ino := range inodes {
+			// the files are small enough to be stored in fragments
+			if _, err := io.ReadAll(ino.Reader()); err != nil {
+				b.Fatalf("failed to read inode %d: %s", ino.Ino, err)
+			}
+		}
+		b.StopTimer()
+
+		frags += atomic.LoadInt64(&decompress)
+		sqfs.Close()
+	}
+	// files sharing a fragment block should only decompress it once, this
+	// should be the number of fragment blocks plus the fragment table
+	b.ReportMetric(float64(frags)/float64(b.N), "decompress/op")
+}
+
+// slowReaderAt simulates a high latency backend
+type slowReaderAt struct {
+	r       io.ReaderAt
+	latency time.Duration
+}
+
+func (s *slowReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	time.Sleep(s.latency)
+	return s.r.ReadAt(p, off)
+}
+
+func benchmarkSequentialRead(b *testing.B, options ...squashfs.Option) {
+	f, err := os.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		b.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer f.Close()
+
+	sqfs, err := squashfs.New(f, options...)
+	if err != nil {
+		b.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+
+	ino, err := sqfs.FindInode("lib/libz.a", false)
+	if err != nil {
+		b.Fatalf("failed to find lib/libz.a: %s", err)
+	}
+	b.SetBytes(int64(ino.Size))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		// fresh superblock so the cache starts empty each time
+		sqfs, err = squashfs.New(&slowReaderAt{r: f, latency: time.Millisecond}, options...)
+		if err != nil {
+			b.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+		}
+		b.StartTimer()
+
+		fp, err := sqfs.Open("lib/libz.a")
+		if err != nil {
+			b.Fatalf("failed to open lib/libz.a: %s", err)
+		}
+		_, err = io.Copy(io.Discard, fp)
+		if err != nil {
+			b.Fatalf("failed to read lib/libz.a: %s", err)
+		}
+	}
+}
+
+func BenchmarkSequentialRead(b *testing.B) {
+	benchmarkSequentialRead(b)
+}
+
+func BenchmarkSequentialReadReadahead(b *testing.B) {
+	benchmarkSequentialRead(b, squashfs.WithReadahead(8))
+}
+
+// offsetReaderAt records how many times each offset of the image is read
+type offsetReaderAt struct {
+	r      io.ReaderAt
+	lk     sync.Mutex
+	reads  map[int64]int
+	closed bool // set by the test once the superblock is closed
+	late   int  // reads started after closed was set
+}
+
+func (o *offsetReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	o.lk.Lock()
+	o.reads[off] += 1
+	if o.closed {
+		o.late += 1
+	}
+	o.lk.Unlock()
+	return o.r.ReadAt(p, off)
+}
+
+func TestReadahead(t *testing.T) {
+	f, err := os.Open("testdata/lz4.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/lz4.squashfs: %s", err)
+	}
+	defer f.Close()
+
+	r := &offsetReaderAt{r: &slowReaderAt{r: f, latency: time.Millisecond}, reads: make(map[int64]int)}
+	sqfs, err := squashfs.New(r, squashfs.WithReadahead(8))
+	if err != nil {
+		t.Fatalf("failed to open testdata/lz4.squashfs: %s", err)
+	}
+
+	// small sequential reads, so the foreground catches up with readahead
+	fp, err := sqfs.Open("doc/words.txt")
+	if err != nil {
+		t.Fatalf("failed to open doc/words.txt: %s", err)
+	}
+	h := sha256.New()
+	_, err = io.CopyBuffer(h, struct{ io.Reader }{fp}, make([]byte, 1024))
+	fp.Close()
+	if err != nil {
+		t.Fatalf("failed to read doc/words.txt: %s", err)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != compressionSamples["doc/words.txt"] {
+		t.Errorf("invalid hash for doc/words.txt")
+	}
+
+	r.lk.Lock()
+	for off, n := range r.reads {
+		if n > 1 {
+			t.Errorf("offset %d was read %d times", off, n)
+		}
+	}
+	r.lk.Unlock()
+
+	// start readahead on another file and close while it runs
+	sqfs, err = squashfs.New(r, squashfs.WithReadahead(8))
+	if err != nil {
+		t.Fatalf("failed to open testdata/lz4.squashfs: %s", err)
+	}
+	ino, err := sqfs.FindInode("doc/words.txt", false)
+	if err != nil {
+		t.Fatalf("failed to find doc/words.txt: %s", err)
+	}
+	buf := make([]byte, sqfs.BlockSize)
+	for off := int64(0); off < 2*int64(len(buf)); off += int64(len(buf)) {
+		if _, err := ino.ReadAt(buf, off); err != nil {
+			t.Fatalf("failed to read doc/words.txt: %s", err)
+		}
+	}
+	sqfs.Close()
+	r.lk.Lock()
+	r.closed = true
+	r.lk.Unlock()
+
+	// give a running prefetch the time to misbehave, at most one block read
+	// may have been started between its check and Close
+	time.Sleep(20 * time.Millisecond)
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if r.late > 1 {
+		t.Errorf("readahead continued after Close with %d reads", r.late)
+	}
+}
+
+func TestRdev(t *testing.T) {
+	// device numbers as encoded by the linux kernel's new_encode_dev()
+	for _, tc := range []struct {
+		dev          uint32
+		major, minor uint32
+	}{
+		{0x0103, 1, 3},       // /dev/null
+		{0x0800, 8, 0},       // /dev/sda
+		{0x11032c, 259, 300}, // nvme partitions use large minors
+	} {
+		ino := &squashfs.Inode{Type: squashfs.CharDevType, DevNum: tc.dev}
+		major, minor := ino.Rdev()
+		if major != tc.major || minor != tc.minor {
+			t.Errorf("Rdev() of %#x = %d,%d, expected %d,%d", tc.dev, major, minor, tc.major, tc.minor)
+		}
+	}
+}
+
+func TestDevices(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/special.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/special.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	for _, tc := range []struct {
+		name         string
+		typ          squashfs.Type
+		major, minor uint32
+		xattr        bool
+	}{
+		{"dev/sda", squashfs.BlockDevType, 8, 0, false},
+		{"dev/null", squashfs.CharDevType, 1, 3, false},
+		{"dev/nvme0n1p300", squashfs.XBlockDevType, 259, 300, true},
+		{"dev/ttyS1", squashfs.XCharDevType, 4, 65, true},
+	} {
+		ino, err := sqfs.FindInode(tc.name, false)
+		if err != nil {
+			t.Errorf("failed to find %s: %s", tc.name, err)
+			continue
+		}
+		if ino.Type != tc.typ {
+			t.Errorf("%s: type is %d, expected %d", tc.name, ino.Type, tc.typ)
+		}
+		if major, minor := ino.Rdev(); major != tc.major || minor != tc.minor {
+			t.Errorf("%s: Rdev() = %d,%d, expected %d,%d", tc.name, major, minor, tc.major, tc.minor)
+		}
+		if ino.NLink != 1 {
+			t.Errorf("%s: nlink is %d, expected 1", tc.name, ino.NLink)
+		}
+		if (ino.XattrIdx != 0xffffffff) != tc.xattr {
+			t.Errorf("%s: unexpected xattr index %#x", tc.name, ino.XattrIdx)
+		}
+	}
+}
+
+func TestIPC(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/special.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/special.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	for _, tc := range []struct {
+		name string
+		typ  squashfs.Type
+		mode fs.FileMode
+	}{
+		{"ipc/fifo", squashfs.FifoType, fs.ModeNamedPipe},
+		{"ipc/socket", squashfs.SocketType, fs.ModeSocket},
+		{"ipc/xfifo", squashfs.XFifoType, fs.ModeNamedPipe},
+		{"ipc/xsocket", squashfs.XSocketType, fs.ModeSocket},
+	} {
+		st, err := sqfs.Stat(tc.name)
+		if err != nil {
+			t.Errorf("failed to stat %s: %s", tc.name, err)
+			continue
+		}
+		if st.Mode() != tc.mode|0666 {
+			t.Errorf("%s: mode is %s, expected %s", tc.name, st.Mode(), tc.mode|0666)
+		}
+		if st.Size() != 0 {
+			t.Errorf("%s: size is %d, expected 0", tc.name, st.Size())
+		}
+		ino := st.Sys().(*squashfs.Inode)
+		if ino.Type != tc.typ || ino.NLink != 1 {
+			t.Errorf("%s: type %d nlink %d, expected type %d nlink 1", tc.name, ino.Type, ino.NLink, tc.typ)
+		}
+	}
+
+	if v, err := sqfs.GetXattr("ipc/xsocket", "user.comment"); err != nil || string(v) != "extended socket" {
+		t.Errorf("getxattr of ipc/xsocket returned %q, err=%v", v, err)
+	}
+}
+
+func TestTypeMode(t *testing.T) {
+	for _, tc := range []struct {
+		typ  squashfs.Type
+		mode fs.FileMode
+	}{
+		{squashfs.FifoType, fs.ModeNamedPipe},
+		{squashfs.XFifoType, fs.ModeNamedPipe},
+		{squashfs.SocketType, fs.ModeSocket},
+		{squashfs.XSocketType, fs.ModeSocket},
+		{squashfs.BlockDevType, fs.ModeDevice},
+		{squashfs.XCharDevType, fs.ModeDevice | fs.ModeCharDevice},
+	} {
+		ino := &squashfs.Inode{Type: tc.typ, Perm: 0644}
+		if mode := ino.Mode(); mode != tc.mode|0644 {
+			t.Errorf("mode of type %d = %s, expected %s", tc.typ, mode, tc.mode|0644)
+		}
+	}
+}
+
+func TestInodeCache(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	ino1, err := sqfs.FindInode("pkgconfig/zlib.pc", false)
+	if err != nil {
+		t.Fatalf("failed to find pkgconfig/zlib.pc: %s", err)
+	}
+	ino2, err := sqfs.FindInode("pkgconfig/zlib.pc", false)
+	if err != nil {
+		t.Fatalf("failed to find pkgconfig/zlib.pc: %s", err)
+	}
+	if ino1 != ino2 {
+		t.Errorf("inode was parsed again instead of being returned from cache")
+	}
+
+	sqfs, err = squashfs.Open("testdata/zlib-dev.squashfs", squashfs.WithInodeCacheSize(0))
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	ino1, _ = sqfs.FindInode("pkgconfig/zlib.pc", false)
+	ino2, _ = sqfs.FindInode("pkgconfig/zlib.pc", false)
+	if ino1 == nil || ino1 == ino2 {
+		t.Errorf("inode was cached while cache is disabled")
+	}
+}
+
+func benchmarkStat(b *testing.B, options ...squashfs.Option) {
+	sqfs, err := squashfs.Open("testdata/bigdir.squashfs", options...)
+	if err != nil {
+		b.Fatalf("failed to open testdata/bigdir.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	stat := func() {
+		for i := 0; i < 1000; i++ {
+			name := fmt.Sprintf("bigdir/%d.txt", i)
+			if _, err := sqfs.Stat(name); err != nil {
+				b.Fatalf("failed to stat %s: %s", name, err)
+			}
+		}
+	}
+
+	// first pass fills the cache, if any
+	stat()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		stat()
+	}
+}
+
+func BenchmarkStat(b *testing.B) {
+	benchmarkStat(b)
+}
+
+func BenchmarkStatNoInodeCache(b *testing.B) {
+	benchmarkStat(b, squashfs.WithInodeCacheSize(0))
+}
+
+func TestCompressorOptions(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/special.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/special.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	if !sqfs.Flags.Has(squashfs.COMPRESSOR_OPTIONS) {
+		t.Fatalf("compressor options flag is not set")
+	}
+	opts, ok := sqfs.CompressorOptions.(*squashfs.GZipOptions)
+	if !ok {
+		t.Fatalf("unexpected compressor options type %T", sqfs.CompressorOptions)
+	}
+	expect := squashfs.GZipOptions{CompressionLevel: 6, WindowSize: 15, Strategies: 1}
+	if *opts != expect {
+		t.Errorf("compressor options are %+v, expected %+v", *opts, expect)
+	}
+
+	// images without options must not have any
+	sqfs, err = squashfs.Open("testdata/lzma.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/lzma.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	if sqfs.Flags.Has(squashfs.COMPRESSOR_OPTIONS) || sqfs.CompressorOptions != nil {
+		t.Errorf("lzma image has compressor options %+v", sqfs.CompressorOptions)
+	}
+}
+
+func TestWithDecompressor(t *testing.T) {
+	var cnt1, cnt2 int64
+	counting := func(cnt *int64) squashfs.Decompressor {
+		dec := squashfs.MakeDecompressorErr(zlib.NewReader)
+		return func(buf []byte) ([]byte, error) {
+			atomic.AddInt64(cnt, 1)
+			return dec(buf)
+		}
+	}
+
+	sqfs1, err := squashfs.Open("testdata/zlib-dev.squashfs", squashfs.WithDecompressor(squashfs.GZip, counting(&cnt1)))
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs1.Close()
+
+	sqfs2, err := squashfs.Open("testdata/zlib-dev.squashfs", squashfs.WithDecompressor(squashfs.GZip, counting(&cnt2)))
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs2.Close()
+
+	before := atomic.LoadInt64(&cnt2)
+	_, err = fs.ReadFile(sqfs1, "include/zlib.h")
+	if err != nil {
+		t.Errorf("failed to read include/zlib.h: %s", err)
+	}
+	if atomic.LoadInt64(&cnt1) == 0 {
+		t.Errorf("per superblock decompressor was not used")
+	}
+	if atomic.LoadInt64(&cnt2) != before {
+		t.Errorf("decompressor of another superblock was used")
+	}
+}
+
+func BenchmarkReadDir(b *testing.B) {
+	var cnt int64
+	dec := squashfs.MakeDecompressorErr(zlib.NewReader)
+	counting := func(buf []byte) ([]byte, error) {
+		atomic.AddInt64(&cnt, 1)
+		return dec(buf)
+	}
+
+	sqfs, err := squashfs.Open("testdata/bigdir.squashfs", squashfs.WithDecompressor(squashfs.GZip, counting))
+	if err != nil {
+		b.Fatalf("failed to open testdata/bigdir.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	b.ResetTimer()
+	atomic.StoreInt64(&cnt, 0)
+
+	for n := 0; n < b.N; n++ {
+		_, err := sqfs.ReadDir("bigdir")
+		if err != nil {
+			b.Fatalf("failed to read bigdir: %s", err)
+		}
+	}
+
+	// metadata blocks are only decompressed during the first iteration
+	b.ReportMetric(float64(atomic.LoadInt64(&cnt))/float64(b.N), "decompressions/op")
+}
+
+func TestRegisterDecompressorRace(t *testing.T) {
+	// run with -race to detect concurrent map accesses
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs", squashfs.WithCacheSize(0))
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 100; n++ {
+			squashfs.RegisterDecompressor(squashfs.LZO, func(buf []byte) ([]byte, error) {
+				return nil, errors.New("not supported")
+			})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 100; n++ {
+			_, err := fs.ReadFile(sqfs, "pkgconfig/zlib.pc")
+			if err != nil {
+				t.Errorf("failed to read pkgconfig/zlib.pc: %s", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestFileWriteTo(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	// zlib.h spans multiple blocks
+	data, err := fs.ReadFile(sqfs, "include/zlib.h")
+	if err != nil {
+		t.Fatalf("failed to read include/zlib.h: %s", err)
+	}
+
+	f, err := sqfs.Open("include/zlib.h")
+	if err != nil {
+		t.Fatalf("failed to open include/zlib.h: %s", err)
+	}
+	defer f.Close()
+
+	buf := &bytes.Buffer{}
+	n, err := f.(io.WriterTo).WriteTo(buf)
+	if err != nil {
+		t.Errorf("failed to copy include/zlib.h: %s", err)
+	} else if n != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("WriteTo of include/zlib.h returned different data than ReadFile")
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	// run with -race to detect unsafe shared state
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	files := []string{"pkgconfig/zlib.pc", "include/zlib.h", "include/zconf.h", "lib/libz.a"}
+	expect := make(map[string]string)
+	for _, name := range files {
+		data, err := fs.ReadFile(sqfs, name)
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", name, err)
+		}
+		expect[name] = s256(data)
+	}
+
+	var wg sync.WaitGroup
+	for n := 0; n < 50; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			name := files[n%len(files)]
+			data, err := fs.ReadFile(sqfs, name)
+			if err != nil {
+				t.Errorf("failed to read %s: %s", name, err)
+			} else if s256(data) != expect[name] {
+				t.Errorf("invalid data read for %s", name)
+			}
+			if _, err := sqfs.ReadDir("lib"); err != nil {
+				t.Errorf("failed to list lib: %s", err)
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+func TestNewAt(t *testing.T) {
+	data, err := os.ReadFile("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to read testdata/zlib-dev.squashfs: %s", err)
+	}
+
+	// prepend junk to the image
+	buf := append(bytes.Repeat([]byte{0x42}, 1234), data...)
+
+	sqfs, err := squashfs.NewAt(bytes.NewReader(buf), 1234)
+	if err != nil {
+		t.Fatalf("failed to open image at offset 1234: %s", err)
+	}
+
+	data, err = fs.ReadFile(sqfs, "pkgconfig/zlib.pc")
+	if err != nil {
+		t.Errorf("failed to read pkgconfig/zlib.pc: %s", err)
+	} else if s256(data) != "2bbfca2364630d3ad2bbc9d44f45fe5470236539a906e11e2072157709e54692" {
+		t.Errorf("invalid hash for pkgconfig/zlib.pc")
+	}
+}
+
+func TestOpenEmbedded(t *testing.T) {
+	data, err := os.ReadFile("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to read testdata/zlib-dev.squashfs: %s", err)
+	}
+
+	// prepend a random sized prefix, aligned to 4kB
+	prefix := (rand.Intn(16) + 1) * 4096
+	buf := append(bytes.Repeat([]byte{0x42}, prefix), data...)
+
+	sqfs, err := squashfs.OpenEmbedded(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatalf("failed to open embedded image: %s", err)
+	}
+
+	_, err = fs.ReadFile(sqfs, "pkgconfig/zlib.pc")
+	if err != nil {
+		t.Errorf("failed to read pkgconfig/zlib.pc: %s", err)
+	}
+
+	offset, err := squashfs.FindEmbedded(bytes.NewReader(buf), int64(len(buf)), 1)
+	if err == nil {
+		t.Errorf("image found at offset %d when scanning only the first candidate", offset)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	for _, name := range []string{"pkgconfig/zlib.pc", "include/zlib.h", "include/zconf.h", "lib/libz.a"} {
+		data, err := sqfs.ReadFile(name)
+		if err != nil {
+			t.Errorf("failed to read %s: %s", name, err)
+			continue
+		}
+		f, err := sqfs.Open(name)
+		if err != nil {
+			t.Errorf("failed to open %s: %s", name, err)
+			continue
+		}
+		expect, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("failed to read %s: %s", name, err)
+		} else if !bytes.Equal(data, expect) {
+			t.Errorf("ReadFile(%s) returned different data than reading the file", name)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/bigdir.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/bigdir.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	// hide Glob() so fs.Glob uses the generic implementation
+	generic := struct{ fs.FS }{sqfs}
+
+	for _, pattern := range []string{"bigdir/9999*.txt", "bigdir/1234?.txt", "big*/5432[0-9].txt", "bigdir/99999.txt", "bigdir/nope*"} {
+		res, err := sqfs.Glob(pattern)
+		if err != nil {
+			t.Errorf("failed to glob %s: %s", pattern, err)
+			continue
+		}
+		expect, err := fs.Glob(generic, pattern)
+		if err != nil {
+			t.Errorf("failed to glob %s: %s", pattern, err)
+			continue
+		}
+		if strings.Join(res, ",") != strings.Join(expect, ",") {
+			t.Errorf("glob %s returned %v, expected %v", pattern, res, expect)
+		}
+	}
+
+	// a literal prefix must use the directory index instead of reading the whole directory
+	f, err := os.Open("testdata/bigdir.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/bigdir.squashfs: %s", err)
+	}
+	defer f.Close()
+
+	globRead := func(glob func(sqfs *squashfs.Superblock) ([]string, error)) int64 {
+		r := &countingReaderAt{r: f}
+		sqfs, err := squashfs.New(r)
+		if err != nil {
+			t.Fatalf("failed to open testdata/bigdir.squashfs: %s", err)
+		}
+		atomic.StoreInt64(&r.cnt, 0)
+		if _, err := glob(sqfs); err != nil {
+			t.Errorf("failed to glob bigdir/9999*.txt: %s", err)
+		}
+		return atomic.LoadInt64(&r.cnt)
+	}
+	indexed := globRead(func(sqfs *squashfs.Superblock) ([]string, error) {
+		return sqfs.Glob("bigdir/9999*.txt")
+	})
+	full := globRead(func(sqfs *squashfs.Superblock) ([]string, error) {
+		return fs.Glob(struct{ fs.FS }{sqfs}, "bigdir/9999*.txt")
+	})
+	if indexed*10 > full {
+		t.Errorf("glob of bigdir/9999*.txt read %d bytes, %d when reading the whole directory", indexed, full)
+	}
+
+	_, err = sqfs.Glob("bigdir/[")
+	if !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("glob of bad pattern returned unexpected err=%s", err)
+	}
+}
+
+func TestReadLink(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	// same method set as fs.ReadLinkFS (go1.25+)
+	var rfs interface {
+		ReadLink(name string) (string, error)
+		Lstat(name string) (fs.FileInfo, error)
+	} = sqfs
+
+	target, err := rfs.ReadLink("lib")
+	if err != nil {
+		t.Errorf("failed to readlink lib: %s", err)
+	} else if target == "" {
+		t.Errorf("readlink lib returned an empty target")
+	}
+
+	_, err = rfs.ReadLink("pkgconfig/zlib.pc")
+	if err == nil {
+		t.Errorf("readlink on a regular file did not fail")
+	}
+}
+
+func TestWriteTar(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	buf := &bytes.Buffer{}
+	err = sqfs.WriteTar(buf)
+	if err != nil {
+		t.Fatalf("failed to write tar: %s", err)
+	}
+
+	found := false
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err != io.EOF {
+				t.Errorf("failed to read tar: %s", err)
+			}
+			break
+		}
+		if hdr.Name != "pkgconfig/zlib.pc" {
+			continue
+		}
+		found = true
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Errorf("failed to read pkgconfig/zlib.pc from tar: %s", err)
+		} else if s256(data) != "2bbfca2364630d3ad2bbc9d44f45fe5470236539a906e11e2072157709e54692" {
+			t.Errorf("invalid hash for pkgconfig/zlib.pc in tar")
+		}
+	}
+	if !found {
+		t.Errorf("pkgconfig/zlib.pc not found in tar")
+	}
+}
+
+func TestNLink(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/special.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/special.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	links := make(map[uint32]int)    // inode number → number of paths
+	nlink := make(map[uint32]uint32) // inode number → NLink
+	err = sqfs.Walk(".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		ino := info.Sys().(*squashfs.Inode)
+		links[ino.Ino] += 1
+		nlink[ino.Ino] = ino.NLink
+
+		if info.Mode()&fs.ModeSocket != 0 {
+			// not supported by tar
+			return nil
+		}
+		// tar headers built from the FileInfo alone must be usable
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			t.Errorf("%s: failed to build tar header: %s", name, err)
+		} else if hdr.Name != path.Base(name) || hdr.ModTime.Unix() != int64(ino.ModTime) {
+			t.Errorf("%s: bad tar header %+v", name, hdr)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk testdata/special.squashfs: %s", err)
+	}
+
+	for ino, cnt := range links {
+		if nlink[ino] != uint32(cnt) {
+			t.Errorf("inode %d has NLink=%d but was found %d times", ino, nlink[ino], cnt)
+		}
+	}
+
+	// hardlink/file and hardlink/link are the same inode
+	file, err := sqfs.Stat("hardlink/file")
+	if err != nil {
+		t.Fatalf("failed to stat hardlink/file: %s", err)
+	}
+	link, err := sqfs.Stat("hardlink/link")
+	if err != nil {
+		t.Fatalf("failed to stat hardlink/link: %s", err)
+	}
+	ino := file.Sys().(*squashfs.Inode)
+	if ino.NLink != 2 || link.Sys().(*squashfs.Inode).Ino != ino.Ino {
+		t.Errorf("hardlink/file has NLink=%d, expected 2 shared with hardlink/link", ino.NLink)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	var res, expect []string
+	err = sqfs.Walk(".", func(name string, d fs.DirEntry, err error) error {
+		res = append(res, name)
+		return err
+	})
+	if err != nil {
+		t.Errorf("failed to walk: %s", err)
+	}
+	err = fs.WalkDir(sqfs, ".", func(name string, d fs.DirEntry, err error) error {
+		expect = append(expect, name)
+		return err
+	})
+	if err != nil {
+		t.Errorf("failed to walk: %s", err)
+	}
+
+	if strings.Join(res, ",") != strings.Join(expect, ",") {
+		t.Errorf("Walk returned %v, expected %v", res, expect)
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		b.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	for n := 0; n < b.N; n++ {
+		sqfs.Walk(".", func(name string, d fs.DirEntry, err error) error { return err })
+	}
+}
+
+func BenchmarkWalkDir(b *testing.B) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		b.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	for n := 0; n < b.N; n++ {
+		fs.WalkDir(sqfs, ".", func(name string, d fs.DirEntry, err error) error { return err })
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	for _, name := range []string{"pkgconfig", "pkgconfig/zlib.pc", "lib/libz.a"} {
+		ino, err := sqfs.FindInode(name, false)
+		if err != nil {
+			t.Errorf("failed to find %s: %s", name, err)
+			continue
+		}
+		p, err := sqfs.GetPath(uint64(ino.Ino))
+		if err != nil {
+			t.Errorf("failed to get path of %s (inode %d): %s", name, ino.Ino, err)
+			continue
+		}
+		// lib is a symlink, so the returned path may differ but must point to the same inode
+		found, err := sqfs.FindInode(p, false)
+		if err != nil {
+			t.Errorf("failed to find %s: %s", p, err)
+		} else if found.Ino != ino.Ino {
+			t.Errorf("GetPath(%d) returned %s which is inode %d", ino.Ino, p, found.Ino)
+		}
+	}
+}
+
+func TestDirectoryLoop(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/special.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/special.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	dir, err := sqfs.FindInode("usr/bin", false)
+	if err != nil {
+		t.Fatalf("failed to find usr/bin: %s", err)
+	}
+	blk, offset := inodeLocation(t, sqfs, "usr/bin")
+	// the parent inode number is at the same offset in basic and extended
+	// directory inodes
+	if offset+32 > len(blk) || binary.LittleEndian.Uint32(blk[offset+28:]) != dir.ParentIno {
+		t.Fatalf("usr/bin inode at offset %d does not match its parent %d", offset, dir.ParentIno)
+	}
+
+	// make usr/bin its own parent as it gets read from the inode table
+	var patched int64
+	dec := squashfs.MakeDecompressorErr(zlib.NewReader)
+	patch := func(buf []byte) ([]byte, error) {
+		buf, err := dec(buf)
+		if err == nil && bytes.Equal(buf, blk) {
+			binary.LittleEndian.PutUint32(buf[offset+28:], dir.Ino)
+			atomic.AddInt64(&patched, 1)
+		}
+		return buf, err
+	}
+
+	loop, err := squashfs.Open("testdata/special.squashfs", squashfs.WithDecompressor(squashfs.GZip, patch))
+	if err != nil {
+		t.Fatalf("failed to open testdata/special.squashfs: %s", err)
+	}
+	defer loop.Close()
+
+	dir, err = loop.FindInode("usr/bin", false)
+	if err != nil {
+		t.Fatalf("failed to find usr/bin: %s", err)
+	}
+	if atomic.LoadInt64(&patched) == 0 || dir.ParentIno != dir.Ino {
+		t.Fatalf("usr/bin inode was not patched, parent is %d", dir.ParentIno)
+	}
+	_, err = loop.GetPath(uint64(dir.Ino))
+	if !errors.Is(err, squashfs.ErrDirectoryLoop) {
+		t.Errorf("GetPath on a directory loop returned unexpected err=%v", err)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	// find the deepest directory
+	deepest, depth := "", 0
+	err = sqfs.Walk(".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if n := strings.Count(name, "/") + 1; d.IsDir() && name != "." && n > depth {
+			deepest, depth = name, n
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk testdata/zlib-dev.squashfs: %s", err)
+	}
+
+	limited, err := squashfs.Open("testdata/zlib-dev.squashfs", squashfs.WithMaxDepth(depth-1))
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer limited.Close()
+
+	if depth == 1 {
+		// WithMaxDepth(0) disables the limit
+		if _, err := limited.FindInode(deepest, false); err != nil {
+			t.Errorf("failed to find %s without depth limit: %s", deepest, err)
+		}
+		return
+	}
+	if _, err := limited.FindInode(deepest, false); !errors.Is(err, squashfs.ErrTooDeep) {
+		t.Errorf("%s returned unexpected err=%v", deepest, err)
+	}
+	err = limited.Walk(".", func(name string, d fs.DirEntry, err error) error {
+		return err
+	})
+	if !errors.Is(err, squashfs.ErrTooDeep) {
+		t.Errorf("walk returned unexpected err=%v", err)
+	}
+}
+
+func TestMaxSymlinkLen(t *testing.T) {
+	for _, tc := range []struct {
+		max int
+		err error
+	}{
+		{4096, nil},
+		{13, nil}, // same length as the target
+		{12, squashfs.ErrSymlinkTooLong},
+	} {
+		sqfs, err := squashfs.Open("testdata/lz4.squashfs", squashfs.WithMaxSymlinkLen(tc.max))
+		if err != nil {
+			t.Fatalf("failed to open testdata/lz4.squashfs: %s", err)
+		}
+
+		target, err := sqfs.ReadLink("link")
+		if !errors.Is(err, tc.err) {
+			t.Errorf("ReadLink with max=%d returned unexpected err=%v", tc.max, err)
+		} else if err == nil && target != "doc/words.txt" {
+			t.Errorf("ReadLink with max=%d returned %q", tc.max, target)
+		}
+		sqfs.Close()
+	}
+}
+
+// xzDecompressor is the XZ decompressor, for tests that alter decompressed data
+var xzDecompressor = squashfs.MakeDecompressorErr(func(r io.Reader) (io.ReadCloser, error) {
+	rc, err := xz.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(rc), nil
+})
+
+// openShortBlocks opens testdata/xz.squashfs with full data blocks
+// decompressing to half of the block size, as with a corrupted image
+func openShortBlocks(t *testing.T) *squashfs.Superblock {
+	sqfs, err := squashfs.Open("testdata/xz.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/xz.squashfs: %s", err)
+	}
+	blockSize := int(sqfs.BlockSize)
+	sqfs.Close()
+
+	short := func(buf []byte) ([]byte, error) {
+		buf, err := xzDecompressor(buf)
+		if err == nil && len(buf) == blockSize {
+			buf = buf[:blockSize/2]
+		}
+		return buf, err
+	}
+	sqfs, err = squashfs.Open("testdata/xz.squashfs", squashfs.WithDecompressor(squashfs.XZ, short))
+	if err != nil {
+		t.Fatalf("failed to open testdata/xz.squashfs: %s", err)
+	}
+	t.Cleanup(func() { sqfs.Close() })
+	return sqfs
+}
+
+func TestShortBlock(t *testing.T) {
+	sqfs := openShortBlocks(t)
+
+	_, err := sqfs.ReadFile("doc/words.txt")
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadFile with short blocks returned unexpected err=%v", err)
+	}
+
+	ino, err := sqfs.FindInode("doc/words.txt", false)
+	if err != nil {
+		t.Fatalf("failed to find doc/words.txt: %s", err)
+	}
+	buf := make([]byte, 16)
+	_, err = ino.ReadAt(buf, int64(sqfs.BlockSize)-8)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadAt with short blocks returned unexpected err=%v", err)
+	}
+
+	fp, err := sqfs.Open("doc/words.txt")
+	if err != nil {
+		t.Fatalf("failed to open doc/words.txt: %s", err)
+	}
+	defer fp.Close()
+	_, err = fp.(io.WriterTo).WriteTo(io.Discard)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("WriteTo with short blocks returned unexpected err=%v", err)
+	}
+
+	// sequential reader, with both Read and WriteTo
+	r := ino.Reader()
+	_, err = io.ReadAll(struct{ io.Reader }{r})
+	r.Close()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Reader().Read with short blocks returned unexpected err=%v", err)
+	}
+	r = ino.Reader()
+	_, err = io.Copy(io.Discard, r)
+	r.Close()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Reader().WriteTo with short blocks returned unexpected err=%v", err)
+	}
+}
+
+func TestCorruptedFileSize(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/xz.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/xz.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	ino, err := sqfs.FindInode("doc/small.txt", false)
+	if err != nil {
+		t.Fatalf("failed to find doc/small.txt: %s", err)
+	}
+	blk, offset := inodeLocation(t, sqfs, "doc/small.txt")
+	if ino.Type != squashfs.FileType || offset+32 > len(blk) || uint64(binary.LittleEndian.Uint32(blk[offset+28:])) != ino.Size {
+		t.Fatalf("doc/small.txt inode at offset %d does not match its size %d", offset, ino.Size)
+	}
+
+	// claim a 4GB size for doc/small.txt as it gets read from the inode table
+	var patched int64
+	patch := func(buf []byte) ([]byte, error) {
+		buf, err := xzDecompressor(buf)
+		if err == nil && bytes.Equal(buf, blk) {
+			binary.LittleEndian.PutUint32(buf[offset+28:], 0xffffffff)
+			atomic.AddInt64(&patched, 1)
+		}
+		return buf, err
+	}
+
+	bad, err := squashfs.Open("testdata/xz.squashfs", squashfs.WithDecompressor(squashfs.XZ, patch))
+	if err != nil {
+		t.Fatalf("failed to open testdata/xz.squashfs: %s", err)
+	}
+	defer bad.Close()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = bad.ReadFile("doc/small.txt")
+	runtime.ReadMemStats(&after)
+
+	if atomic.LoadInt64(&patched) == 0 {
+		t.Fatalf("doc/small.txt inode was not patched")
+	}
+	if err == nil {
+		t.Errorf("ReadFile of a file with a corrupted size did not fail")
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 64<<20 {
+		t.Errorf("ReadFile of a file with a corrupted size allocated %d bytes", n)
+	}
+}
+
+func TestOwner(t *testing.T) {
+	sqfs, err := squashfs.Open("testdata/zlib-dev.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/zlib-dev.squashfs: %s", err)
+	}
+	defer sqfs.Close()
+
+	// all inodes must reference valid entries of the id table
+	err = sqfs.Walk(".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		ino := info.Sys().(*squashfs.Inode)
+		if int(ino.UidIdx) >= int(sqfs.IdCount) || int(ino.GidIdx) >= int(sqfs.IdCount) {
+			t.Errorf("%s references an id outside of the id table", name)
+		}
+
+		// ownership is available without knowing about squashfs
+		owner, ok := info.Sys().(interface {
+			Uid() uint32
+			Gid() uint32
+		})
+		if !ok {
+			t.Errorf("%s: Sys() does not expose Uid() and Gid()", name)
+		} else if owner.Uid() != ino.GetUid() || owner.Gid() != ino.GetGid() {
+			t.Errorf("%s: Uid()/Gid() do not match GetUid()/GetGid()", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("failed to walk: %s", err)
+	}
+
+	// boundaries of the id table, on an image with several ids
+	ids, err := squashfs.Open("testdata/lz4.squashfs")
+	if err != nil {
+		t.Fatalf("failed to open testdata/lz4.squashfs: %s", err)
+	}
+	defer ids.Close()
+
+	ino, err := ids.FindInode("many/file002", false)
+	if err != nil {
+		t.Fatalf("failed to find many/file002: %s", err)
+	}
+	if ino.Uid() != 1002 || int(ino.UidIdx) != int(ids.IdCount)-1 {
+		t.Fatalf("many/file002 is owned by %d (index %d), expected 1002 as the last id", ino.Uid(), ino.UidIdx)
+	}
+
+	last := *ino
+	last.GidIdx = ids.IdCount - 1
+	if last.Uid() != 1002 || last.Gid() != 1002 {
+		t.Errorf("last id table entry returned uid=%d gid=%d, expected 1002", last.Uid(), last.Gid())
+	}
+	past := *ino
+	past.UidIdx = ids.IdCount
+	past.GidIdx = ids.IdCount
+	if past.Uid() != 0 || past.Gid() != 0 {
+		t.Errorf("index past the id table returned uid=%d gid=%d, expected 0", past.Uid(), past.Gid())
+	}
+}
@@ -0,0 +1,51 @@
+package squashfs
+
+import (
+	"io/fs"
+	"path"
+)
+
+// subFS is a fs.FS rooted at a given directory inode, see SubAtInode
+type subFS struct {
+	sb   *Superblock
+	root *Inode
+}
+
+var _ fs.StatFS = (*subFS)(nil)
+
+// SubAtInode returns a fs.FS presenting the content of the given directory
+// inode as its root, similar to fs.Sub but without needing the directory's
+// path. As with FindInodeUnder, it is not possible to access files outside
+// of this directory, including through symlinks.
+func (sb *Superblock) SubAtInode(ino *Inode) (fs.FS, error) {
+	if !ino.IsDir() {
+		return nil, ErrNotDirectory
+	}
+	return &subFS{sb: sb, root: ino}, nil
+}
+
+func (s *subFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	ino, err := s.sb.FindInodeUnder(s.root, name, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return ino.OpenFile(path.Base(name)), nil
+}
+
+func (s *subFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	ino, err := s.sb.FindInodeUnder(s.root, name, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	return &fileinfo{name: path.Base(name), ino: ino}, nil
+}
@@ -1,14 +1,18 @@
 package squashfs
 
 import (
+	"context"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"io/fs"
+	"math"
 	"os"
 	"path"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 const SuperblockSize = 96
@@ -17,9 +21,11 @@ const SuperblockSize = 96
 // the file. You can ignore most of these and use the object directly to access files/etc, or inspect
 // various elements of the squashfs image.
 type Superblock struct {
-	fs    io.ReaderAt
-	order binary.ByteOrder
-	clos  io.Closer
+	fs     io.ReaderAt
+	order  binary.ByteOrder
+	clos   io.Closer
+	closL  sync.Mutex
+	closed int32 // set by Close, stops readahead
 
 	rootIno  *Inode
 	rootInoN uint64
@@ -28,6 +34,26 @@ type Superblock struct {
 	inoOfft  uint64
 	idTable  []uint32
 
+	blockCache *blockCache // decompressed data blocks
+	inoCache   *inodeCache // parsed inodes, by inode number
+	metaCache  *metaCache  // decompressed metadata blocks
+	readahead  int         // number of blocks to prefetch on sequential reads, see WithReadahead
+	raL        sync.Mutex  // protects the readahead state of inodes
+	maxDepth   int         // maximum directory nesting, see WithMaxDepth
+	maxSymLen  int         // maximum symlink target length, see WithMaxSymlinkLen
+	fragIdx    map[uint32]fragEntry
+	fragIdxL   sync.RWMutex
+
+	decompressHandler map[Compression]Decompressor // per superblock handlers, see WithDecompressor
+	symlinkRoot       string                       // archive root for absolute symlinks, see WithSymlinkRoot
+
+	pathIdx  map[uint32]string // inode number → path cache, see GetPath
+	pathIdxL sync.RWMutex
+
+	size     uint64 // total size of files, see UncompressedSize
+	sizeDone bool
+	sizeL    sync.Mutex
+
 	Magic             uint32 // magic identifier
 	InodeCnt          uint32 // number of inodes in filesystem
 	ModTime           int32  // creation unix time as int32 (will stop working in 2038)
@@ -47,23 +73,49 @@ type Superblock struct {
 	DirTableStart     uint64
 	FragTableStart    uint64
 	ExportTableStart  uint64
+
+	// CompressorOptions holds the compressor options found after the superblock
+	// if any, as one of *GZipOptions, *XZOptions, *LZ4Options, *ZSTDOptions or
+	// *LZOOptions.
+	CompressorOptions any
 }
 
 var _ fs.FS = (*Superblock)(nil)
 var _ fs.ReadDirFS = (*Superblock)(nil)
 var _ fs.StatFS = (*Superblock)(nil)
+var _ fs.ReadFileFS = (*Superblock)(nil)
+
+// defaultMaxDepth is the default maximum directory nesting, see WithMaxDepth
+const defaultMaxDepth = 1024
+
+// defaultMaxSymlinkLen is the default maximum symlink target length, see WithMaxSymlinkLen
+const defaultMaxSymlinkLen = 4096
 
 // New returns a new instance of superblock for a given io.ReaderAt that can
 // be used to access files inside squashfs.
 func New(fs io.ReaderAt, options ...Option) (*Superblock, error) {
 	sb := &Superblock{fs: fs,
-		inoIdx: make(map[uint32]inodeRef),
+		inoIdx:     make(map[uint32]inodeRef),
+		blockCache: newBlockCache(defaultCacheSize),
+		inoCache:   newInodeCache(defaultInodeCacheSize),
+		metaCache:  newMetaCache(defaultMetaCacheSize),
+		maxDepth:   defaultMaxDepth,
+		maxSymLen:  defaultMaxSymlinkLen,
+		fragIdx:    make(map[uint32]fragEntry),
+		pathIdx:    make(map[uint32]string),
 	}
 	head := make([]byte, SuperblockSize)
 
-	_, err := fs.ReadAt(head, 0)
-	if err != nil {
-		return nil, err
+	n, err := fs.ReadAt(head, 0)
+	if err != nil && n < len(head) {
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		switch string(head[:4]) {
+		case "hsqs", "sqsh":
+			return nil, fmt.Errorf("%w: superblock at offset 0", ErrTruncatedArchive)
+		}
+		return nil, ErrInvalidFile
 	}
 	err = sb.UnmarshalBinary(head)
 	if err != nil {
@@ -74,6 +126,11 @@ func New(fs io.ReaderAt, options ...Option) (*Superblock, error) {
 		return nil, ErrInvalidVersion
 	}
 
+	err = sb.checkTables()
+	if err != nil {
+		return nil, err
+	}
+
 	// apply options
 	for _, opt := range options {
 		err = opt(sb)
@@ -82,6 +139,11 @@ func New(fs io.ReaderAt, options ...Option) (*Superblock, error) {
 		}
 	}
 
+	err = sb.readCompressorOptions()
+	if err != nil {
+		return nil, err
+	}
+
 	// get root inode
 	sb.rootIno, err = sb.GetInodeRef(sb.RootInode)
 	if err != nil {
@@ -90,20 +152,39 @@ func New(fs io.ReaderAt, options ...Option) (*Superblock, error) {
 
 	sb.rootInoN = uint64(sb.rootIno.Ino)
 
-	sb.readIdTable()
+	err = sb.readIdTable()
+	if err != nil {
+		return nil, err
+	}
 
 	return sb, nil
 }
 
+// NewAt returns a new instance of superblock for a squashfs image that starts
+// at a given offset of an io.ReaderAt, for example when the image has been
+// appended to an executable.
+func NewAt(fs io.ReaderAt, offset int64, options ...Option) (*Superblock, error) {
+	if offset == 0 {
+		return New(fs, options...)
+	}
+	return New(io.NewSectionReader(fs, offset, math.MaxInt64-offset), options...)
+}
+
 // Open returns a new instance of superblock for a given file that can
 // be used to access files inside squashfs. The file will be closed by
 // the garbage collector or when Close() is called on the superblock.
 func Open(file string, options ...Option) (*Superblock, error) {
+	return OpenAt(file, 0, options...)
+}
+
+// OpenAt is similar to Open but the squashfs image starts at a given offset
+// in the file.
+func OpenAt(file string, offset int64, options ...Option) (*Superblock, error) {
 	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
 	}
-	sb, err := New(f, options...)
+	sb, err := NewAt(f, offset, options...)
 	if err != nil {
 		f.Close()
 		return nil, err
@@ -117,6 +198,55 @@ func Open(file string, options ...Option) (*Superblock, error) {
 	return sb, nil
 }
 
+// checkTables ensures the tables offsets found in the superblock are within
+// the image and do not overlap the inode table, so that corrupted or hostile
+// images are rejected early. Other tables may appear in any order, as not all
+// tools write them in the same order as mksquashfs.
+func (sb *Superblock) checkTables() error {
+	if sb.InodeTableStart < SuperblockSize || sb.InodeTableStart >= sb.DirTableStart {
+		return fmt.Errorf("%w: inode table at %d, directory table at %d", ErrInvalidSuper, sb.InodeTableStart, sb.DirTableStart)
+	}
+
+	tables := []struct {
+		name  string
+		start uint64
+	}{
+		{"directory", sb.DirTableStart},
+		{"fragment", sb.FragTableStart},
+		{"export", sb.ExportTableStart},
+		{"id", sb.IdTableStart},
+		{"xattr", sb.XattrIdTableStart},
+	}
+
+	for _, t := range tables {
+		if t.start == ^uint64(0) {
+			// table not present
+			continue
+		}
+		if t.start < SuperblockSize || (t.start >= sb.InodeTableStart && t.start < sb.DirTableStart) {
+			return fmt.Errorf("%w: %s table at %d overlaps the superblock or inode table", ErrInvalidSuper, t.name, t.start)
+		}
+		if t.start >= sb.BytesUsed {
+			return fmt.Errorf("%w: %s table at %d is past end of image (%d bytes)", ErrInvalidSuper, t.name, t.start, sb.BytesUsed)
+		}
+	}
+
+	return nil
+}
+
+// readAt reads len(buf) bytes at the given offset of the image. If the image
+// ends before that, an error wrapping ErrTruncatedArchive is returned.
+func (sb *Superblock) readAt(buf []byte, off int64, what string) error {
+	n, err := sb.fs.ReadAt(buf, off)
+	if err != nil && n < len(buf) {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: %s at offset %d", ErrTruncatedArchive, what, off)
+		}
+		return err
+	}
+	return nil
+}
+
 func (sb *Superblock) readIdTable() error {
 	// read id table
 	idtable, err := sb.newIndirectTableReader(int64(sb.IdTableStart), 0)
@@ -208,6 +338,8 @@ func (s *Superblock) FindInodeUnder(cur *Inode, name string, followSymlinks bool
 	// similar to lookup, but handles slashes in name and returns an inode
 	parents := make(map[uint32]*Inode)
 	parents[cur.Ino] = cur
+	start := cur
+	depth := 0
 	symlinkRedirects := 40 // maximum number of redirects before giving up
 
 	for {
@@ -218,14 +350,18 @@ func (s *Superblock) FindInodeUnder(cur *Inode, name string, followSymlinks bool
 		pos := strings.IndexByte(name, '/')
 		if pos == -1 {
 			// no / - perform final lookup
-			if !followSymlinks {
-				return cur.lookupRelativeInode(name)
+			if name == "." {
+				// fs.FS uses "." for the root directory
+				return cur, nil
 			}
 			res, err := cur.lookupRelativeInode(name)
 			if err != nil {
 				return nil, err
 			}
-			if !res.Type.IsSymlink() {
+			if res.IsDir() && s.tooDeep(depth+1) {
+				return nil, ErrTooDeep
+			}
+			if !followSymlinks || !res.Type.IsSymlink() {
 				return res, nil
 			}
 
@@ -238,10 +374,19 @@ func (s *Superblock) FindInodeUnder(cur *Inode, name string, followSymlinks bool
 			if err != nil {
 				return nil, err
 			}
-			// ensure symlink isn't empty and isn't absolute either
-			if len(sym) == 0 || sym[0] == '/' {
+			if len(sym) == 0 {
 				return nil, fs.ErrInvalid
 			}
+			if sym[0] == '/' {
+				// absolute symlinks are only allowed if a symlink root has been set
+				rel, ok := s.symlinkTarget(string(sym))
+				if !ok {
+					return nil, fs.ErrInvalid
+				}
+				cur = start
+				depth = 0
+				sym = []byte(rel)
+			}
 			// continue lookup from that point
 			name = string(sym)
 			continue
@@ -263,6 +408,9 @@ func (s *Superblock) FindInodeUnder(cur *Inode, name string, followSymlinks bool
 			// special case: move to parent dir
 			name = name[pos+1:]
 			cur = parents[cur.Ino]
+			if depth > 0 {
+				depth -= 1
+			}
 			continue
 		}
 		t, err := cur.lookupRelativeInode(name[:pos])
@@ -280,10 +428,19 @@ func (s *Superblock) FindInodeUnder(cur *Inode, name string, followSymlinks bool
 			if err != nil {
 				return nil, err
 			}
-			// ensure symlink isn't empty and isn't absolute either
-			if len(sym) == 0 || sym[0] == '/' {
+			if len(sym) == 0 {
 				return nil, fs.ErrInvalid
 			}
+			if sym[0] == '/' {
+				// absolute symlinks are only allowed if a symlink root has been set
+				rel, ok := s.symlinkTarget(string(sym))
+				if !ok {
+					return nil, fs.ErrInvalid
+				}
+				cur = start
+				depth = 0
+				sym = []byte(rel)
+			}
 			// prepend symlink to name & remove symlink
 			// if symlink a=b and name=a/c it becomes b/c
 			name = string(sym) + name[pos:] // no +1 to pos means we keep the / we had in name
@@ -294,6 +451,10 @@ func (s *Superblock) FindInodeUnder(cur *Inode, name string, followSymlinks bool
 		if !t.IsDir() {
 			return nil, ErrNotDirectory
 		}
+		depth += 1
+		if s.tooDeep(depth) {
+			return nil, ErrTooDeep
+		}
 
 		// move forward
 		parents[t.Ino] = cur
@@ -302,6 +463,77 @@ func (s *Superblock) FindInodeUnder(cur *Inode, name string, followSymlinks bool
 	}
 }
 
+// FindInodeNoFollow returns the inode for a given path without resolving any
+// symlink. If a symlink is found in the middle of the path, ErrSymlinkInPath is
+// returned. A symlink as the last path component is returned as is, similar to
+// Lstat. This is useful when extracting untrusted archives, as it guarantees
+// the result is located where the path says.
+func (s *Superblock) FindInodeNoFollow(name string) (*Inode, error) {
+	cur := s.rootIno
+	parents := make(map[uint32]*Inode)
+	parents[cur.Ino] = cur
+	depth := 0
+
+	for _, elem := range strings.Split(name, "/") {
+		if elem == "" {
+			// initial, trailing or subsequent /
+			continue
+		}
+		if cur.Type.IsSymlink() {
+			return nil, ErrSymlinkInPath
+		}
+		if !cur.IsDir() {
+			return nil, ErrNotDirectory
+		}
+		switch elem {
+		case ".":
+			continue
+		case "..":
+			cur = parents[cur.Ino]
+			if depth > 0 {
+				depth -= 1
+			}
+			continue
+		}
+		t, err := cur.lookupRelativeInode(elem)
+		if err != nil {
+			return nil, err
+		}
+		if t.IsDir() {
+			depth += 1
+			if s.tooDeep(depth) {
+				return nil, ErrTooDeep
+			}
+		}
+		parents[t.Ino] = cur
+		cur = t
+	}
+	return cur, nil
+}
+
+// symlinkTarget returns the path of an absolute symlink target relative to
+// the archive root, or false if no symlink root was set or the target is not
+// under it. See WithSymlinkRoot.
+func (s *Superblock) symlinkTarget(sym string) (string, bool) {
+	switch {
+	case s.symlinkRoot == "":
+		return "", false
+	case s.symlinkRoot == "/":
+		return sym[1:], true
+	case sym == s.symlinkRoot:
+		return "", true
+	case strings.HasPrefix(sym, s.symlinkRoot+"/"):
+		return sym[len(s.symlinkRoot)+1:], true
+	}
+	return "", false
+}
+
+// tooDeep returns true if depth exceeds the maximum directory nesting set
+// with WithMaxDepth
+func (s *Superblock) tooDeep(depth int) bool {
+	return s.maxDepth > 0 && depth > s.maxDepth
+}
+
 // Open returns a fs.File for a given path, which can be a different object depending
 // if the file is a regular file or a directory.
 func (sb *Superblock) Open(name string) (fs.File, error) {
@@ -317,13 +549,66 @@ func (sb *Superblock) Open(name string) (fs.File, error) {
 	return ino.OpenFile(path.Base(name)), nil
 }
 
-// Readlink allows reading the value of a symbolic link inside the archive.
-func (sb *Superblock) Readlink(name string) (string, error) {
+// ReadFile implements fs.ReadFileFS and returns the whole contents of a file,
+// decoding each block directly into the returned buffer.
+func (sb *Superblock) ReadFile(name string) ([]byte, error) {
+	return sb.ReadFileContext(context.Background(), name)
+}
+
+// ReadFileContext is similar to ReadFile, but stops and returns an error
+// wrapping ctx.Err() if the context is cancelled while the file is read.
+func (sb *Superblock) ReadFileContext(ctx context.Context, name string) ([]byte, error) {
 	if !fs.ValidPath(name) {
-		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
 	}
 
 	ino, err := sb.FindInode(name, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+
+	switch ino.Type {
+	case 2, 9:
+		// regular file
+	default:
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+
+	// the on-disk size is not trusted for the allocation, a corrupted inode
+	// could otherwise panic or exhaust memory before a block is read
+	prealloc := ino.Size
+	if max := uint64(len(ino.Blocks)) * uint64(sb.BlockSize); prealloc > max {
+		prealloc = max
+	}
+	res := make([]byte, 0, prealloc)
+	for block := 0; uint64(len(res)) < ino.Size; block++ {
+		if err := ctx.Err(); err != nil {
+			return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+		}
+		buf, err := ino.readBlock(block)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+		}
+		if len(buf) == 0 {
+			// should not happen unless the image is corrupted
+			return nil, &fs.PathError{Op: "readfile", Path: name, Err: io.ErrUnexpectedEOF}
+		}
+		res = append(res, buf...)
+	}
+	return res, nil
+}
+
+// ReadLink implements fs.ReadLinkFS and allows reading the value of a
+// symbolic link inside the archive.
+func (sb *Superblock) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+
+	ino, err := sb.FindInode(name, false)
 	if err != nil {
 		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
 	}
@@ -335,6 +620,11 @@ func (sb *Superblock) Readlink(name string) (string, error) {
 	return string(res), nil
 }
 
+// Readlink is an alias of ReadLink kept for compatibility.
+func (sb *Superblock) Readlink(name string) (string, error) {
+	return sb.ReadLink(name)
+}
+
 // ReadDir implements fs.ReadDirFS and allows listing any directory inside the archive
 func (sb *Superblock) ReadDir(name string) ([]fs.DirEntry, error) {
 	if !fs.ValidPath(name) {
@@ -351,11 +641,15 @@ func (sb *Superblock) ReadDir(name string) ([]fs.DirEntry, error) {
 		// basic dir, we need to iterate (cache data?)
 		dr, err := sb.dirReader(ino, nil)
 		if err != nil {
-			return nil, err
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		res, err := dr.ReadDir(0)
+		if err != nil {
+			return res, &fs.PathError{Op: "readdir", Path: name, Err: err}
 		}
-		return dr.ReadDir(0)
+		return res, nil
 	default:
-		return nil, fs.ErrInvalid
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
 	}
 }
 
@@ -367,7 +661,7 @@ func (sb *Superblock) Stat(name string) (fs.FileInfo, error) {
 
 	ino, err := sb.FindInode(name, true)
 	if err != nil {
-		return nil, err
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
 	}
 
 	return &fileinfo{name: path.Base(name), ino: ino}, nil
@@ -382,16 +676,48 @@ func (sb *Superblock) Lstat(name string) (fs.FileInfo, error) {
 
 	ino, err := sb.FindInode(name, false)
 	if err != nil {
-		return nil, err
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
 	}
 
 	return &fileinfo{name: path.Base(name), ino: ino}, nil
 }
 
+// DirIndex returns a copy of the index of a given directory. Only extended
+// directories have an index, which mksquashfs builds with one entry for each
+// metadata block after the first one. An empty list is returned for
+// directories without index.
+func (sb *Superblock) DirIndex(name string) ([]DirIndexEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "dirindex", Path: name, Err: fs.ErrInvalid}
+	}
+
+	ino, err := sb.FindInode(name, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "dirindex", Path: name, Err: err}
+	}
+	if !ino.IsDir() {
+		return nil, &fs.PathError{Op: "dirindex", Path: name, Err: ErrNotDirectory}
+	}
+
+	res := make([]DirIndexEntry, len(ino.DirIndex))
+	for n, di := range ino.DirIndex {
+		res[n] = *di
+	}
+	return res, nil
+}
+
 // Close will close the underlying file when a filesystem was open with Open()
 func (sb *Superblock) Close() error {
+	sb.closL.Lock()
+	defer sb.closL.Unlock()
+
+	atomic.StoreInt32(&sb.closed, 1)
 	if sb.clos != nil {
-		return sb.clos.Close()
+		// no need for the finalizer anymore
+		runtime.SetFinalizer(sb, nil)
+		err := sb.clos.Close()
+		sb.clos = nil
+		return err
 	}
 	return nil
 }
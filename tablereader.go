@@ -1,11 +1,18 @@
 package squashfs
 
 import (
+	"container/list"
 	"fmt"
 	"io"
+	"sync"
 )
 
-// TODO add buf cache to allow multiple accesses to same block without re-reading
+// MetadataBlockSize is the maximum size of a decompressed metadata block
+const MetadataBlockSize = 8192
+
+// defaultMetaCacheSize is the default number of decompressed metadata blocks (8kB each) kept in memory
+const defaultMetaCacheSize = 128
+
 type tableReader struct {
 	sb    *Superblock
 	buf   []byte
@@ -62,18 +69,48 @@ func (i *tableReader) readBlock() error {
 	if i.tofft != 0 {
 		// tofft mode
 		buf := make([]byte, 8)
-		_, err := i.sb.fs.ReadAt(buf, i.tofft)
+		err := i.sb.readAt(buf, i.tofft, "table index")
 		if err != nil {
 			return err
 		}
 		i.offt = int64(i.sb.order.Uint64(buf))
 	}
-	buf := make([]byte, 2)
-	_, err := i.sb.fs.ReadAt(buf, i.offt)
+	blk, err := i.sb.readMetadataBlock(i.offt)
 	if err != nil {
 		return err
 	}
-	lenN := i.sb.order.Uint16(buf)
+	i.offt = blk.next
+	i.buf = blk.data
+
+	return nil
+}
+
+// ReadMetadataBlock returns the decompressed metadata block found at a given
+// offset in the image, and the offset of the block following it. Metadata
+// blocks hold up to MetadataBlockSize bytes each, and are chained to store
+// the inode, directory, fragment, export, id and xattr tables.
+func (sb *Superblock) ReadMetadataBlock(offset int64) ([]byte, int64, error) {
+	blk, err := sb.readMetadataBlock(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	// cached blocks are shared, do not let the caller modify them
+	return append([]byte(nil), blk.data...), blk.next, nil
+}
+
+// readMetadataBlock returns the metadata block at a given offset, from cache
+// if possible. The returned data is shared and must not be modified.
+func (sb *Superblock) readMetadataBlock(offt int64) (*metaBlock, error) {
+	if blk, ok := sb.metaCache.get(offt); ok {
+		return blk, nil
+	}
+
+	buf := make([]byte, 2)
+	err := sb.readAt(buf, offt, "metadata block")
+	if err != nil {
+		return nil, err
+	}
+	lenN := sb.order.Uint16(buf)
 	nocompressFlag := false
 
 	if lenN&0x8000 == 0x8000 {
@@ -82,26 +119,32 @@ func (i *tableReader) readBlock() error {
 		lenN = lenN & 0x7fff
 	}
 
-	buf = make([]byte, int(lenN))
+	if nocompressFlag {
+		buf = make([]byte, int(lenN))
+	} else {
+		// compressed data is only needed until decompressed
+		p := getBuf(int(lenN))
+		defer putBuf(p)
+		buf = *p
+	}
 
 	// read data
-	_, err = i.sb.fs.ReadAt(buf, i.offt+2)
+	err = sb.readAt(buf, offt+2, "metadata block")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	i.offt += int64(lenN) + 2
 	if !nocompressFlag {
 		// decompress
-		buf, err = i.sb.Comp.decompress(buf)
+		buf, err = sb.decompress(buf)
 		if err != nil {
 			//log.Printf("squashfs: failed to read compressed data: %s", err)
-			return err
+			return nil, err
 		}
 	}
 
-	i.buf = buf
-
-	return nil
+	blk := &metaBlock{key: offt, data: buf, next: offt + int64(lenN) + 2}
+	sb.metaCache.add(blk)
+	return blk, nil
 }
 
 func (i *tableReader) Read(p []byte) (int, error) {
@@ -122,3 +165,64 @@ func (i *tableReader) Read(p []byte) (int, error) {
 
 	return n, nil
 }
+
+// metaBlock is a decompressed metadata block, with the offset of the block
+// following it in the image
+type metaBlock struct {
+	key  int64
+	data []byte
+	next int64
+}
+
+// metaCache is a LRU cache of decompressed metadata blocks keyed by their
+// offset in the image, shared by all table readers of a superblock.
+type metaCache struct {
+	lk    sync.Mutex
+	max   int
+	lru   *list.List
+	items map[int64]*list.Element
+}
+
+func newMetaCache(max int) *metaCache {
+	return &metaCache{
+		max:   max,
+		lru:   list.New(),
+		items: make(map[int64]*list.Element),
+	}
+}
+
+func (c *metaCache) get(key int64) (*metaBlock, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*metaBlock), true
+}
+
+func (c *metaCache) add(blk *metaBlock) {
+	if c.max <= 0 {
+		// cache disabled
+		return
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if e, ok := c.items[blk.key]; ok {
+		// already added by someone else
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	c.items[blk.key] = c.lru.PushFront(blk)
+
+	for c.lru.Len() > c.max {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.items, e.Value.(*metaBlock).key)
+	}
+}
@@ -0,0 +1,90 @@
+package squashfs
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// WriteTar writes the whole content of the archive to w as a tar stream,
+// including ownership, permissions, modification times, symlinks and device
+// nodes. Files sharing the same inode are stored as hard links. Sockets cannot
+// be represented in tar archives and are skipped.
+func (sb *Superblock) WriteTar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	links := make(map[uint32]string) // inode number → first path
+
+	err := fs.WalkDir(sb, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		ino := info.Sys().(*Inode)
+
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    int64(ino.Perm & 07777),
+			Uid:     int(ino.GetUid()),
+			Gid:     int(ino.GetGid()),
+			ModTime: time.Unix(int64(ino.ModTime), 0),
+			Format:  tar.FormatPAX,
+		}
+
+		switch ino.Type.Basic() {
+		case DirType:
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+		case FileType:
+			if first, ok := links[ino.Ino]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				break
+			}
+			links[ino.Ino] = name
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(ino.Size)
+		case SymlinkType:
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = string(ino.SymTarget)
+		case CharDevType, BlockDevType:
+			hdr.Typeflag = tar.TypeChar
+			if ino.Type.Basic() == BlockDevType {
+				hdr.Typeflag = tar.TypeBlock
+			}
+			major, minor := ino.Rdev()
+			hdr.Devmajor = int64(major)
+			hdr.Devminor = int64(minor)
+		case FifoType:
+			hdr.Typeflag = tar.TypeFifo
+		default:
+			// sockets, etc
+			return nil
+		}
+
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			return err
+		}
+
+		if hdr.Typeflag == tar.TypeReg && hdr.Size > 0 {
+			f := ino.OpenFile(name).(*File)
+			_, err = io.Copy(tw, f)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
@@ -0,0 +1,728 @@
+//go:build ignore
+
+// mkimage writes the squashfs test images that cannot be built from the
+// other testdata files, following the squashfs 4.0 on-disk format as
+// documented in the linux kernel (fs/squashfs/squashfs_fs.h) and written by
+// mksquashfs. The output is fully deterministic.
+//
+// Usage, from the repository root:
+//
+//	go run testdata/mkimage.go
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const (
+	metadataSize = 8192
+	mtime        = 1600000000
+	noTable      = ^uint64(0)
+
+	flagExportable = 0x80
+	flagNoXattrs   = 0x200
+	flagCompOpt    = 0x400
+)
+
+var le = binary.LittleEndian
+
+// compressor compresses a block, returning nil if the data did not compress
+type compressor struct {
+	id       uint16
+	compress func(in []byte) []byte
+	options  []byte // compressor options, written after the superblock if not nil
+}
+
+// gzipCompressor returns a gzip compressor. Like mksquashfs, options are only
+// written if the compression level or strategies differ from the defaults.
+// Strategies is a bitfield, 1 being the default strategy.
+func gzipCompressor(level int, strategies uint16) *compressor {
+	c := &compressor{
+		id: 1,
+		compress: func(in []byte) []byte {
+			var out bytes.Buffer
+			w, _ := zlib.NewWriterLevel(&out, level)
+			w.Write(in)
+			w.Close()
+			if out.Len() >= len(in) {
+				return nil
+			}
+			return out.Bytes()
+		},
+	}
+	if level != zlib.BestCompression || strategies != 0 {
+		c.options = make([]byte, 8)
+		le.PutUint32(c.options[0:], uint32(level))
+		le.PutUint16(c.options[4:], 15) // window size
+		le.PutUint16(c.options[6:], strategies)
+	}
+	return c
+}
+
+func lz4Compressor() *compressor {
+	opts := make([]byte, 8)
+	le.PutUint32(opts[0:], 1) // version: LZ4_LEGACY
+	le.PutUint32(opts[4:], 1) // flags: LZ4_HC
+	return &compressor{
+		id: 5,
+		compress: func(in []byte) []byte {
+			out := make([]byte, lz4.CompressBlockBound(len(in)))
+			n, err := lz4.CompressBlockHC(in, out, lz4.Level9, nil, nil)
+			if err != nil {
+				log.Fatalf("lz4: %s", err)
+			}
+			if n == 0 || n >= len(in) {
+				return nil
+			}
+			return out[:n]
+		},
+		options: opts,
+	}
+}
+
+// xzCompressor returns a xz compressor. Like mksquashfs, options are only
+// written if the dictionary size differs from the block size.
+func xzCompressor(dictSize, blockSize uint32) *compressor {
+	opts := make([]byte, 8)
+	le.PutUint32(opts[0:], dictSize)
+	c := &compressor{
+		id: 4,
+		compress: func(in []byte) []byte {
+			var out bytes.Buffer
+			w, err := xz.WriterConfig{CheckSum: xz.CRC32, DictCap: int(dictSize)}.NewWriter(&out)
+			if err != nil {
+				log.Fatalf("xz: %s", err)
+			}
+			w.Write(in)
+			if err := w.Close(); err != nil {
+				log.Fatalf("xz: %s", err)
+			}
+			if out.Len() >= len(in) {
+				return nil
+			}
+			return out.Bytes()
+		},
+	}
+	if dictSize != blockSize {
+		c.options = opts
+	}
+	return c
+}
+
+func lzmaCompressor() *compressor {
+	return &compressor{
+		id: 2,
+		compress: func(in []byte) []byte {
+			var out bytes.Buffer
+			w, err := lzma.WriterConfig{SizeInHeader: true, Size: int64(len(in))}.NewWriter(&out)
+			if err != nil {
+				log.Fatalf("lzma: %s", err)
+			}
+			w.Write(in)
+			if err := w.Close(); err != nil {
+				log.Fatalf("lzma: %s", err)
+			}
+			if out.Len() >= len(in) {
+				return nil
+			}
+			return out.Bytes()
+		},
+	}
+}
+
+// node is a file, directory or symlink in the generated image
+type node struct {
+	name     string
+	typ      uint16 // basic inode type
+	perm     uint16
+	uid, gid uint32
+	data     []byte
+	target   string
+	rdev     uint32 // device number, as encoded by linux new_encode_dev()
+	children []*node
+	parent   *node
+	xattrs   []string // name, value pairs
+	link     *node    // for hard links, the node linked to
+	links    uint32   // number of hard links to this node
+
+	ino  uint32
+	iref uint64 // inode reference, metadata block << 16 | offset
+
+	// set when writing file data
+	start  uint64
+	blocks []uint32
+	frag   uint32
+	fragOf uint32
+}
+
+func dir(name string, children ...*node) *node {
+	n := &node{name: name, typ: 1, perm: 0755, children: children}
+	for _, c := range children {
+		c.parent = n
+	}
+	return n
+}
+
+func file(name string, data []byte) *node {
+	return &node{name: name, typ: 2, perm: 0644, data: data}
+}
+
+func symlink(name, target string) *node {
+	return &node{name: name, typ: 3, perm: 0777, target: target}
+}
+
+// device returns a block (typ 4) or char (typ 5) device
+func device(name string, typ uint16, major, minor uint32) *node {
+	rdev := minor&0xff | major<<8 | (minor&^0xff)<<12
+	return &node{name: name, typ: typ, perm: 0660, rdev: rdev}
+}
+
+// ipc returns a fifo (typ 6) or socket (typ 7)
+func ipc(name string, typ uint16) *node {
+	return &node{name: name, typ: typ, perm: 0666}
+}
+
+// hardlink returns an additional directory entry for target, which must be
+// written before the directory containing the link
+func hardlink(name string, target *node) *node {
+	target.links += 1
+	return &node{name: name, typ: target.typ, link: target}
+}
+
+func withXattrs(n *node, kv ...string) *node {
+	n.xattrs = kv
+	return n
+}
+
+// extended returns true if n needs an extended inode
+func (n *node) extended() bool {
+	return len(n.xattrs) > 0 || n.links > 0
+}
+
+// metaWriter writes a stream of metadata blocks, and knows the reference of
+// the next byte to be written
+type metaWriter struct {
+	c   *compressor
+	out bytes.Buffer // written blocks
+	buf []byte       // pending data of the current block
+}
+
+func (m *metaWriter) ref() uint64 {
+	return uint64(m.out.Len())<<16 | uint64(len(m.buf))
+}
+
+func (m *metaWriter) Write(p []byte) (int, error) {
+	m.buf = append(m.buf, p...)
+	for len(m.buf) >= metadataSize {
+		m.flushBlock(m.buf[:metadataSize])
+		m.buf = m.buf[metadataSize:]
+	}
+	return len(p), nil
+}
+
+func (m *metaWriter) flushBlock(blk []byte) {
+	var hdr [2]byte
+	if c := m.c.compress(blk); c != nil {
+		le.PutUint16(hdr[:], uint16(len(c)))
+		m.out.Write(hdr[:])
+		m.out.Write(c)
+		return
+	}
+	le.PutUint16(hdr[:], uint16(len(blk))|0x8000)
+	m.out.Write(hdr[:])
+	m.out.Write(blk)
+}
+
+// bytes flushes the last block and returns the whole stream
+func (m *metaWriter) bytes() []byte {
+	if len(m.buf) > 0 {
+		m.flushBlock(m.buf)
+		m.buf = nil
+	}
+	return m.out.Bytes()
+}
+
+func (m *metaWriter) put(v ...any) {
+	for _, x := range v {
+		if s, ok := x.(string); ok {
+			m.Write([]byte(s))
+			continue
+		}
+		binary.Write(m, le, x)
+	}
+}
+
+type image struct {
+	c         *compressor
+	blockSize uint32
+	out       []byte
+	ids       []uint32
+	nodes     []*node // by inode number - 1
+	frags     [][2]uint64
+	fragBuf   []byte
+
+	xattrKV     *metaWriter
+	xattrIds    []byte
+	xattrSets   map[string]uint32
+	xattrValues map[string]uint64
+}
+
+func (img *image) id(v uint32) uint16 {
+	for n, id := range img.ids {
+		if id == v {
+			return uint16(n)
+		}
+	}
+	img.ids = append(img.ids, v)
+	return uint16(len(img.ids) - 1)
+}
+
+// xattrIndex stores the xattrs of n and returns their index in the xattr id
+// table. Like mksquashfs, identical sets of xattrs are only stored once, and
+// values that were already stored are written as out of line references.
+func (img *image) xattrIndex(n *node) uint32 {
+	if len(n.xattrs) == 0 {
+		return 0xffffffff
+	}
+	key := strings.Join(n.xattrs, "\x00")
+	if idx, ok := img.xattrSets[key]; ok {
+		return idx
+	}
+
+	ref := img.xattrKV.ref()
+	size := 0
+	for i := 0; i < len(n.xattrs); i += 2 {
+		name, value := n.xattrs[i], n.xattrs[i+1]
+		typ := uint16(0xffff)
+		for t, prefix := range []string{"user.", "trusted.", "security."} {
+			if strings.HasPrefix(name, prefix) {
+				typ = uint16(t)
+				name = name[len(prefix):]
+			}
+		}
+		if typ == 0xffff {
+			log.Fatalf("unsupported xattr %s", name)
+		}
+
+		vref, ool := img.xattrValues[value]
+		if ool {
+			typ |= 0x100
+		}
+		img.xattrKV.put(typ, uint16(len(name)), name)
+		if ool {
+			img.xattrKV.put(uint32(8), vref)
+		} else {
+			img.xattrValues[value] = img.xattrKV.ref()
+			img.xattrKV.put(uint32(len(value)), value)
+		}
+		size += len(n.xattrs[i]) + 1 + len(value)
+	}
+
+	idx := uint32(len(img.xattrSets))
+	img.xattrSets[key] = idx
+	img.xattrIds = le.AppendUint64(img.xattrIds, ref)
+	img.xattrIds = le.AppendUint32(img.xattrIds, uint32(len(n.xattrs)/2))
+	img.xattrIds = le.AppendUint32(img.xattrIds, uint32(size))
+	return idx
+}
+
+// writeBlock writes a data block, returning its on-disk size field
+func (img *image) writeBlock(blk []byte) uint32 {
+	if c := img.c.compress(blk); c != nil {
+		img.out = append(img.out, c...)
+		return uint32(len(c))
+	}
+	img.out = append(img.out, blk...)
+	return uint32(len(blk)) | 1<<24
+}
+
+func (img *image) flushFragment() {
+	if len(img.fragBuf) == 0 {
+		return
+	}
+	start := uint64(len(img.out))
+	size := img.writeBlock(img.fragBuf)
+	img.frags = append(img.frags, [2]uint64{start, uint64(size)})
+	img.fragBuf = nil
+}
+
+func (img *image) writeData(n *node) {
+	bs := int(img.blockSize)
+	n.start = uint64(len(img.out))
+	n.frag = 0xffffffff
+	full := len(n.data) / bs
+	for b := 0; b < full; b++ {
+		n.blocks = append(n.blocks, img.writeBlock(n.data[b*bs:(b+1)*bs]))
+	}
+	if tail := n.data[full*bs:]; len(tail) > 0 {
+		if len(img.fragBuf)+len(tail) > bs {
+			img.flushFragment()
+		}
+		n.frag = uint32(len(img.frags))
+		n.fragOf = uint32(len(img.fragBuf))
+		img.fragBuf = append(img.fragBuf, tail...)
+	}
+}
+
+// number assigns inode numbers the way mksquashfs does: the entries of a
+// directory come before the directory itself
+func (img *image) number(n *node) {
+	sort.Slice(n.children, func(i, j int) bool { return n.children[i].name < n.children[j].name })
+	for _, c := range n.children {
+		if c.typ == 1 {
+			img.number(c)
+		}
+	}
+	for _, c := range n.children {
+		if c.typ != 1 && c.link == nil {
+			img.nodes = append(img.nodes, c)
+			c.ino = uint32(len(img.nodes))
+		}
+	}
+	img.nodes = append(img.nodes, n)
+	n.ino = uint32(len(img.nodes))
+}
+
+// writeTree writes the inodes and directory listings of n and everything
+// below it, children first so their references are known
+func (img *image) writeTree(n *node, inodes, dirs *metaWriter) {
+	for _, c := range n.children {
+		if c.typ == 1 {
+			img.writeTree(c, inodes, dirs)
+		}
+	}
+	for _, c := range n.children {
+		if c.typ != 1 && c.link == nil {
+			img.writeInode(c, inodes, 0, 0)
+		}
+	}
+	for _, c := range n.children {
+		if c.link != nil {
+			c.ino, c.iref = c.link.ino, c.link.iref
+		}
+	}
+
+	// directory listing, entries grouped by inode metadata block
+	listing := dirs.ref()
+	size := 0
+	for i := 0; i < len(n.children); {
+		grp := n.children[i:]
+		if len(grp) > 256 {
+			grp = grp[:256]
+		}
+		for j := range grp {
+			if grp[j].iref>>16 != grp[0].iref>>16 {
+				grp = grp[:j]
+				break
+			}
+		}
+		before := dirs.out.Len() + len(dirs.buf)
+		dirs.put(uint32(len(grp)-1), uint32(grp[0].iref>>16), grp[0].ino)
+		for _, c := range grp {
+			dirs.put(uint16(c.iref&0xffff), int16(int32(c.ino)-int32(grp[0].ino)), c.typ, uint16(len(c.name)-1), c.name)
+		}
+		size += dirs.out.Len() + len(dirs.buf) - before
+		i += len(grp)
+	}
+	img.writeInode(n, inodes, listing, size+3)
+}
+
+func (img *image) writeInode(n *node, inodes *metaWriter, listing uint64, listingSize int) {
+	n.iref = inodes.ref()
+	typ := n.typ
+	if n.extended() {
+		typ += 7
+	}
+	inodes.put(typ, n.perm, img.id(n.uid), img.id(n.gid), int32(mtime), n.ino)
+	switch typ {
+	case 1, 8:
+		parent := uint32(len(img.nodes) + 1)
+		if n.parent != nil {
+			parent = n.parent.ino
+		}
+		nlink := uint32(2)
+		for _, c := range n.children {
+			if c.typ == 1 {
+				nlink += 1
+			}
+		}
+		if typ == 1 {
+			inodes.put(uint32(listing>>16), nlink, uint16(listingSize), uint16(listing&0xffff), parent)
+		} else {
+			inodes.put(nlink, uint32(listingSize), uint32(listing>>16), parent, uint16(0), uint16(listing&0xffff), img.xattrIndex(n))
+		}
+	case 2:
+		inodes.put(uint32(n.start), n.frag, n.fragOf, uint32(len(n.data)), n.blocks)
+	case 9:
+		inodes.put(n.start, uint64(len(n.data)), uint64(0), 1+n.links, n.frag, n.fragOf, img.xattrIndex(n), n.blocks)
+	case 3:
+		inodes.put(uint32(1), uint32(len(n.target)), n.target)
+	case 10:
+		inodes.put(uint32(1), uint32(len(n.target)), n.target, img.xattrIndex(n))
+	case 4, 5:
+		inodes.put(uint32(1), n.rdev)
+	case 11, 12:
+		inodes.put(uint32(1), n.rdev, img.xattrIndex(n))
+	case 6, 7:
+		inodes.put(uint32(1))
+	case 13, 14:
+		inodes.put(uint32(1), img.xattrIndex(n))
+	}
+}
+
+// writeBlocks writes data in metadata blocks of their own, returning their
+// positions
+func (img *image) writeBlocks(data []byte) []uint64 {
+	var ptrs []uint64
+	for len(data) > 0 {
+		blk := data
+		if len(blk) > metadataSize {
+			blk = blk[:metadataSize]
+		}
+		data = data[len(blk):]
+		ptrs = append(ptrs, uint64(len(img.out)))
+		m := &metaWriter{c: img.c}
+		m.Write(blk)
+		img.out = append(img.out, m.bytes()...)
+	}
+	return ptrs
+}
+
+// writeTable writes a table in metadata blocks followed by the list of
+// pointers to these blocks, returning the position of the pointers
+func (img *image) writeTable(data []byte) uint64 {
+	ptrs := img.writeBlocks(data)
+	start := uint64(len(img.out))
+	for _, p := range ptrs {
+		img.out = le.AppendUint64(img.out, p)
+	}
+	return start
+}
+
+func build(root *node, c *compressor, blockSize uint32) []byte {
+	img := &image{
+		c:           c,
+		blockSize:   blockSize,
+		out:         make([]byte, 96),
+		xattrKV:     &metaWriter{c: c},
+		xattrSets:   make(map[string]uint32),
+		xattrValues: make(map[string]uint64),
+	}
+	flags := uint16(flagExportable)
+	if c.options != nil {
+		flags |= flagCompOpt
+		m := &metaWriter{c: &compressor{compress: func([]byte) []byte { return nil }}}
+		m.Write(c.options)
+		img.out = append(img.out, m.bytes()...)
+	}
+
+	img.number(root)
+	for _, n := range img.nodes {
+		if n.typ == 2 {
+			img.writeData(n)
+		}
+	}
+	img.flushFragment()
+
+	inodes := &metaWriter{c: c}
+	dirs := &metaWriter{c: c}
+	img.writeTree(root, inodes, dirs)
+
+	inodeStart := uint64(len(img.out))
+	img.out = append(img.out, inodes.bytes()...)
+	dirStart := uint64(len(img.out))
+	img.out = append(img.out, dirs.bytes()...)
+
+	fragStart := noTable
+	if len(img.frags) > 0 {
+		var tbl []byte
+		for _, f := range img.frags {
+			tbl = le.AppendUint64(tbl, f[0])
+			tbl = le.AppendUint32(tbl, uint32(f[1]))
+			tbl = le.AppendUint32(tbl, 0)
+		}
+		fragStart = img.writeTable(tbl)
+	}
+
+	var export []byte
+	for _, n := range img.nodes {
+		export = le.AppendUint64(export, n.iref)
+	}
+	exportStart := img.writeTable(export)
+
+	var ids []byte
+	for _, id := range img.ids {
+		ids = le.AppendUint32(ids, id)
+	}
+	idStart := img.writeTable(ids)
+
+	xattrStart := noTable
+	if len(img.xattrIds) > 0 {
+		kvStart := uint64(len(img.out))
+		img.out = append(img.out, img.xattrKV.bytes()...)
+		ptrs := img.writeBlocks(img.xattrIds)
+		xattrStart = uint64(len(img.out))
+		img.out = le.AppendUint64(img.out, kvStart)
+		img.out = le.AppendUint32(img.out, uint32(len(img.xattrSets)))
+		img.out = le.AppendUint32(img.out, 0)
+		for _, p := range ptrs {
+			img.out = le.AppendUint64(img.out, p)
+		}
+	} else {
+		flags |= flagNoXattrs
+	}
+
+	blockLog := uint16(0)
+	for 1<<blockLog < blockSize {
+		blockLog++
+	}
+
+	sb := img.out[:0]
+	sb = append(sb, "hsqs"...)
+	sb = le.AppendUint32(sb, uint32(len(img.nodes)))
+	sb = le.AppendUint32(sb, mtime)
+	sb = le.AppendUint32(sb, blockSize)
+	sb = le.AppendUint32(sb, uint32(len(img.frags)))
+	sb = le.AppendUint16(sb, c.id)
+	sb = le.AppendUint16(sb, blockLog)
+	sb = le.AppendUint16(sb, flags)
+	sb = le.AppendUint16(sb, uint16(len(img.ids)))
+	sb = le.AppendUint16(sb, 4)
+	sb = le.AppendUint16(sb, 0)
+	sb = le.AppendUint64(sb, root.iref)
+	sb = le.AppendUint64(sb, uint64(len(img.out)))
+	sb = le.AppendUint64(sb, idStart)
+	sb = le.AppendUint64(sb, xattrStart)
+	sb = le.AppendUint64(sb, inodeStart)
+	sb = le.AppendUint64(sb, dirStart)
+	sb = le.AppendUint64(sb, fragStart)
+	le.AppendUint64(sb, exportStart)
+
+	// mksquashfs pads images to 4k
+	if pad := len(img.out) % 4096; pad != 0 {
+		img.out = append(img.out, make([]byte, 4096-pad)...)
+	}
+	return img.out
+}
+
+// compressionSample is a tree exercising the different kinds of blocks
+func compressionSample() *node {
+	rnd := rand.New(rand.NewSource(42))
+	words := []string{"squashfs", "block", "fragment", "inode", "directory", "table", "compressed", "the", "a", "of"}
+	var text bytes.Buffer
+	for i := 0; i < 12000; i++ {
+		if i > 0 {
+			text.WriteByte(' ')
+		}
+		text.WriteString(words[rnd.Intn(len(words))])
+	}
+	text.WriteByte('\n')
+	random := make([]byte, 10000)
+	rnd.Read(random)
+
+	var many []*node
+	for i := 0; i < 400; i++ {
+		// enough inodes and entries to span several metadata blocks
+		f := file(fmt.Sprintf("file%03d", i), bytes.Repeat([]byte(fmt.Sprintf("%d\n", i)), i%7))
+		f.uid = 1000 + uint32(i%3)
+		many = append(many, f)
+	}
+
+	return dir("",
+		dir("doc",
+			file("words.txt", text.Bytes()),            // many compressible blocks plus a fragment
+			file("random.bin", random),                 // uncompressible blocks
+			file("small.txt", []byte("hello world\n")), // fragment only
+			file("empty", nil),
+		),
+		dir("many", many...),
+		symlink("link", "doc/words.txt"),
+	)
+}
+
+func hardlinks() *node {
+	f := file("file", []byte("hard linked\n"))
+	return dir("hardlink", f, hardlink("link", f))
+}
+
+// smallFiles returns 500 files small enough to be packed in fragments
+func smallFiles() *node {
+	var files []*node
+	for i := 0; i < 500; i++ {
+		files = append(files, file(fmt.Sprintf("%03d", i), []byte(strings.Repeat(fmt.Sprintf("small file %d\n", i), 1+i%5))))
+	}
+	return dir("small", files...)
+}
+
+// specialSample is a tree with the less common kinds of inodes and metadata
+func specialSample() *node {
+	return dir("",
+		// absolute symlinks, for WithSymlinkRoot
+		dir("bin",
+			symlink("sh", "/usr/bin/sh"),
+			symlink("app-sh", "/srv/app/usr/bin/sh"),
+		),
+		dir("usr", dir("bin", file("sh", []byte("#!/bin/false\n")))),
+		dir("dev",
+			device("null", 5, 1, 3),
+			device("sda", 4, 8, 0),
+			withXattrs(device("ttyS1", 5, 4, 65), "security.selinux", "system_u:object_r:tty_device_t:s0\x00"),
+			withXattrs(device("nvme0n1p300", 4, 259, 300), "security.selinux", "system_u:object_r:fixed_disk_device_t:s0\x00"),
+		),
+		hardlinks(),
+		dir("ipc",
+			ipc("fifo", 6),
+			ipc("socket", 7),
+			withXattrs(ipc("xfifo", 6), "user.comment", "extended fifo"),
+			withXattrs(ipc("xsocket", 7), "user.comment", "extended socket"),
+		),
+		smallFiles(),
+		withXattrs(dir("xattr",
+			withXattrs(file("file", []byte("xattr test\n")),
+				"user.comment", "hello world",
+				"trusted.overlay.opaque", "y",
+				"security.selinux", "system_u:object_r:etc_t:s0\x00",
+			),
+			// same xattrs as file, sharing the same xattr id
+			withXattrs(symlink("link", "file"),
+				"user.comment", "hello world",
+				"trusted.overlay.opaque", "y",
+				"security.selinux", "system_u:object_r:etc_t:s0\x00",
+			),
+			withXattrs(file("shared", []byte("xattr shared\n")),
+				"user.comment", "hello world", // already stored, written out of line
+				"user.mime_type", "text/plain",
+			),
+		), "user.dir", "1"),
+	)
+}
+
+func main() {
+	for _, img := range []struct {
+		name      string
+		tree      func() *node
+		c         *compressor
+		blockSize uint32
+	}{
+		{"testdata/lz4.squashfs", compressionSample, lz4Compressor(), 4096},
+		{"testdata/xz.squashfs", compressionSample, xzCompressor(8192, 16384), 16384}, // mksquashfs -b 16k -Xdict-size 8k
+		{"testdata/lzma.squashfs", compressionSample, lzmaCompressor(), 4096},
+		{"testdata/special.squashfs", specialSample, gzipCompressor(6, 1), 4096}, // -Xcompression-level 6 -Xstrategy default
+	} {
+		if err := os.WriteFile(img.name, build(img.tree(), img.c, img.blockSize), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
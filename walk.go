@@ -0,0 +1,106 @@
+package squashfs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"path"
+)
+
+// Walk walks the file tree rooted at root, calling fn for each file or
+// directory in the tree, including root, in lexical order. It behaves like
+// fs.WalkDir but reuses the inodes found while reading each directory instead
+// of resolving every path again from the root.
+func (sb *Superblock) Walk(root string, fn fs.WalkDirFunc) error {
+	return sb.WalkContext(context.Background(), root, fn)
+}
+
+// WalkContext is similar to Walk, but stops and returns ctx.Err() as soon as
+// the context is cancelled, checking it before each entry.
+func (sb *Superblock) WalkContext(ctx context.Context, root string, fn fs.WalkDirFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ino, err := sb.FindInode(root, true)
+	if err != nil {
+		err = fn(root, nil, &fs.PathError{Op: "stat", Path: root, Err: err})
+	} else {
+		d := fs.FileInfoToDirEntry(&fileinfo{name: path.Base(root), ino: ino})
+		err = sb.walkDir(ctx, root, d, ino, 0, fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (sb *Superblock) walkDir(ctx context.Context, name string, d fs.DirEntry, ino *Inode, depth int, fn fs.WalkDirFunc) error {
+	if err := fn(name, d, nil); err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			// successfully skipped directory
+			err = nil
+		}
+		return err
+	}
+
+	dr, err := sb.dirReader(ino, nil)
+	if err != nil {
+		// second call, to report the error
+		err = fn(name, d, err)
+		if err != nil {
+			if err == fs.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for dr != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ename, typ, inoR, err := dr.nextfull()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			err = fn(name, d, err)
+			if err == fs.SkipDir {
+				err = nil
+			}
+			return err
+		}
+
+		de := &direntry{ename, typ, inoR, dr.lastIno, sb}
+		name1 := path.Join(name, ename)
+
+		if typ.IsDir() {
+			var child *Inode
+			if sb.tooDeep(depth + 1) {
+				err = ErrTooDeep
+			} else {
+				child, err = sb.loadInode(dr.lastIno, inoR)
+			}
+			if err != nil {
+				err = fn(name1, de, err)
+			} else {
+				err = sb.walkDir(ctx, name1, de, child, depth+1, fn)
+			}
+			if err != nil {
+				if err == fs.SkipDir {
+					break
+				}
+				return err
+			}
+			continue
+		}
+
+		if err := fn(name1, de, nil); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package squashfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// xattr key types, the lower 8 bits of the type select the name prefix
+const (
+	xattrTypeUser     = 0
+	xattrTypeTrusted  = 1
+	xattrTypeSecurity = 2
+
+	xattrValueOOL = 0x100 // value is stored out of line, as a reference to another value
+)
+
+var xattrPrefix = map[uint16]string{
+	xattrTypeUser:     "user.",
+	xattrTypeTrusted:  "trusted.",
+	xattrTypeSecurity: "security.",
+}
+
+// ListXattrs returns all the extended attributes attached to this inode, as a
+// map of full attribute names (including prefix such as "user.") to values.
+func (i *Inode) ListXattrs() (map[string][]byte, error) {
+	res := make(map[string][]byte)
+	err := i.readXattrs(func(name string, value []byte) bool {
+		res[name] = value
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetXattr returns the value of a given extended attribute, or fs.ErrNotExist
+// if the inode has no such attribute.
+func (i *Inode) GetXattr(name string) ([]byte, error) {
+	var res []byte
+	found := false
+	err := i.readXattrs(func(n string, value []byte) bool {
+		if n == name {
+			res = value
+			found = true
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fs.ErrNotExist
+	}
+	return res, nil
+}
+
+// GetXattr returns the value of an extended attribute for a given path inside
+// the archive. Symlinks are not followed for the final element.
+func (sb *Superblock) GetXattr(name, attr string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: fs.ErrInvalid}
+	}
+
+	ino, err := sb.FindInode(name, false)
+	if err != nil {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: err}
+	}
+
+	res, err := ino.GetXattr(attr)
+	if err != nil {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: err}
+	}
+	return res, nil
+}
+
+// readXattrs calls cb for each xattr of the inode until cb returns false
+func (i *Inode) readXattrs(cb func(name string, value []byte) bool) error {
+	if i.XattrIdx == 0xffffffff || i.sb.XattrIdTableStart == ^uint64(0) {
+		// no xattrs
+		return nil
+	}
+
+	// read xattr id table header: kv table start (u64), count (u32), unused (u32)
+	head := make([]byte, 16)
+	err := i.sb.readAt(head, int64(i.sb.XattrIdTableStart), "xattr id table")
+	if err != nil {
+		return err
+	}
+	kvStart := i.sb.order.Uint64(head[:8])
+	if i.XattrIdx >= i.sb.order.Uint32(head[8:12]) {
+		return errors.New("xattr index out of range")
+	}
+
+	// each id entry is 16 bytes, so 512 entries per metadata block
+	blInfo := make([]byte, 8)
+	err = i.sb.readAt(blInfo, int64(i.sb.XattrIdTableStart)+16+int64(i.XattrIdx/512)*8, "xattr id table")
+	if err != nil {
+		return err
+	}
+
+	t, err := i.sb.newTableReader(int64(i.sb.order.Uint64(blInfo)), int(i.XattrIdx%512)*16)
+	if err != nil {
+		return err
+	}
+
+	var ref uint64
+	var count, size uint32
+	err = binary.Read(t, i.sb.order, &ref)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(t, i.sb.order, &count)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(t, i.sb.order, &size)
+	if err != nil {
+		return err
+	}
+
+	kv, err := i.sb.newTableReader(int64(kvStart+(ref>>16)), int(ref&0xffff))
+	if err != nil {
+		return err
+	}
+
+	for n := uint32(0); n < count; n += 1 {
+		var typ, nameLen uint16
+		err = binary.Read(kv, i.sb.order, &typ)
+		if err != nil {
+			return err
+		}
+		err = binary.Read(kv, i.sb.order, &nameLen)
+		if err != nil {
+			return err
+		}
+		name := make([]byte, nameLen)
+		_, err = io.ReadFull(kv, name)
+		if err != nil {
+			return err
+		}
+		prefix, ok := xattrPrefix[typ&0xff]
+		if !ok {
+			return errors.New("unknown xattr prefix type")
+		}
+
+		value, err := readXattrValue(kv, i.sb.order)
+		if err != nil {
+			return err
+		}
+
+		if typ&xattrValueOOL == xattrValueOOL {
+			// value is a reference to the actual value
+			if len(value) != 8 {
+				return errors.New("invalid out of line xattr value reference")
+			}
+			vref := i.sb.order.Uint64(value)
+			vr, err := i.sb.newTableReader(int64(kvStart+(vref>>16)), int(vref&0xffff))
+			if err != nil {
+				return err
+			}
+			value, err = readXattrValue(vr, i.sb.order)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !cb(prefix+string(name), value) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func readXattrValue(r io.Reader, order binary.ByteOrder) ([]byte, error) {
+	var l uint32
+	err := binary.Read(r, order, &l)
+	if err != nil {
+		return nil, err
+	}
+	if l > 65536 {
+		// linux limits xattr values to 64kB
+		return nil, errors.New("xattr value too long")
+	}
+	value := make([]byte, l)
+	_, err = io.ReadFull(r, value)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}